@@ -0,0 +1,126 @@
+// Package audit keeps a durable record of security events. Each record
+// carries the hash of the one before it, so editing, removing or reordering
+// stored records breaks the chain and is caught by Verify.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/mlog"
+)
+
+type EventType string
+
+const (
+	LoginSucceeded  EventType = "login.succeeded"
+	LoginFailed     EventType = "login.failed"
+	TokenRefreshed  EventType = "token.refreshed"
+	Logout          EventType = "logout"
+	PasswordChanged EventType = "password.changed"
+	RoleGranted     EventType = "role.granted"
+	AccountDeleted  EventType = "account.deleted"
+)
+
+// Event is what a caller records. ActorID is who acted; SubjectID is the
+// account acted on and defaults to the actor.
+type Event struct {
+	Type      EventType
+	ActorID   string
+	SubjectID string
+	Reason    string
+	Details   map[string]string
+}
+
+// Record is a stored event. Hash covers every other field, including
+// PrevHash, the hash of the record before it.
+type Record struct {
+	Seq       int64             `bson:"_id" json:"seq"`
+	Time      time.Time         `bson:"time" json:"time"`
+	Type      EventType         `bson:"type" json:"type"`
+	ActorID   string            `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	SubjectID string            `bson:"subject_id,omitempty" json:"subject_id,omitempty"`
+	Reason    string            `bson:"reason,omitempty" json:"reason,omitempty"`
+	Details   map[string]string `bson:"details,omitempty" json:"details,omitempty"`
+	IP        string            `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string            `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	RequestID string            `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	PrevHash  string            `bson:"prev_hash" json:"prev_hash"`
+	Hash      string            `bson:"hash" json:"hash"`
+}
+
+// ComputeHash hashes the record with Hash left out. Time is hashed at
+// millisecond precision in UTC, which is what Mongo stores.
+func (r Record) ComputeHash() string {
+	r.Hash = ""
+	r.Time = r.Time.UTC().Truncate(time.Millisecond)
+	b, _ := json.Marshal(r)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// next builds the record that follows prev, or the first record when prev is
+// nil.
+func next(ctx context.Context, prev *Record, event Event, now time.Time) Record {
+	record := Record{
+		Seq:       1,
+		Time:      now.UTC().Truncate(time.Millisecond),
+		Type:      event.Type,
+		ActorID:   event.ActorID,
+		SubjectID: event.SubjectID,
+		Reason:    event.Reason,
+		Details:   event.Details,
+		RequestID: mlog.RequestID(ctx),
+	}
+	if record.SubjectID == "" {
+		record.SubjectID = record.ActorID
+	}
+	if source, ok := ctx.Value(sourceKey).(Source); ok {
+		record.IP, record.UserAgent = source.IP, source.UserAgent
+	}
+	if prev != nil {
+		record.Seq, record.PrevHash = prev.Seq+1, prev.Hash
+	}
+	record.Hash = record.ComputeHash()
+	return record
+}
+
+// Recorder appends events to the audit log.
+type Recorder interface {
+	Record(ctx context.Context, event Event) error
+}
+
+type discard struct{}
+
+func (discard) Record(context.Context, Event) error { return nil }
+
+// Discard drops every event.
+var Discard Recorder = discard{}
+
+type contextKey string
+
+const sourceKey contextKey = "audit.source"
+
+// Source is where a request came from.
+type Source struct {
+	IP        string
+	UserAgent string
+}
+
+func WithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, sourceKey, source)
+}
+
+// Middleware stores the client address and user agent in the request
+// context for the records made while serving it.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := WithSource(c.Request.Context(), Source{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/router"
+)
+
+// Register serves the audit query API. middleware should restrict it to
+// administrators.
+func Register(r router.MyRouter, log *Log, middleware ...gin.HandlerFunc) router.MyRouter {
+	r.GET("/api/v1/audit/events", append(middleware, log.list)...)
+	return r
+}
+
+// list answers GET /api/v1/audit/events?type=&actor=&subject=&from=&to=&after=&limit=
+// with from and to in RFC 3339.
+func (l *Log) list(c *gin.Context) {
+	logger := mlog.L(c.Request.Context())
+	query := Query{
+		Type:      EventType(c.Query("type")),
+		ActorID:   c.Query("actor"),
+		SubjectID: c.Query("subject"),
+	}
+
+	var err error
+	parseTime := func(name string, dst *time.Time) {
+		if value := c.Query(name); value != "" && err == nil {
+			*dst, err = time.Parse(time.RFC3339, value)
+		}
+	}
+	parseInt := func(name string, dst *int64) {
+		if value := c.Query(name); value != "" && err == nil {
+			*dst, err = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	parseTime("from", &query.From)
+	parseTime("to", &query.To)
+	parseInt("after", &query.AfterSeq)
+	parseInt("limit", &query.Limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	records, err := l.Find(c.Request.Context(), query)
+	if err != nil {
+		logger.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "audit query failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "audit events", "data": records})
+}
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sing3demons/auth-service/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultDatabase   = "auth"
+	DefaultCollection = "audit_events"
+
+	appendAttempts = 10
+	maxQueryLimit  = 1000
+)
+
+type Config struct {
+	Database   string
+	Collection string
+}
+
+// Log stores records in a Mongo collection keyed by sequence number. The
+// unique _id makes concurrent writers from several instances race for the
+// next number; the loser re-reads the tail and tries again.
+type Log struct {
+	store  store.Store
+	config Config
+	now    func() time.Time
+	mu     sync.Mutex
+}
+
+func NewLog(client store.Store, config Config) *Log {
+	if config.Database == "" {
+		config.Database = DefaultDatabase
+	}
+	if config.Collection == "" {
+		config.Collection = DefaultCollection
+	}
+	return &Log{store: client, config: config, now: time.Now}
+}
+
+func (l *Log) collection() store.Collection {
+	return l.store.Database(l.config.Database).Collection(l.config.Collection)
+}
+
+func (l *Log) Record(ctx context.Context, event Event) error {
+	_, err := l.Append(ctx, event)
+	return err
+}
+
+// Append stores event at the end of the chain and returns its record.
+func (l *Log) Append(ctx context.Context, event Event) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		last, err := l.Last(ctx)
+		if err != nil {
+			return Record{}, err
+		}
+		record := next(ctx, last, event, l.now())
+		_, err = l.collection().InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("audit: %w", err)
+		}
+		return record, nil
+	}
+	return Record{}, errors.New("audit: too many concurrent writers")
+}
+
+// Last returns the newest record, or nil when the log is empty.
+func (l *Log) Last(ctx context.Context) (*Record, error) {
+	var record Record
+	err := l.collection().FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	return &record, nil
+}
+
+// Query filters records. Zero fields match everything; records come back
+// in sequence order starting after AfterSeq.
+type Query struct {
+	Type      EventType
+	ActorID   string
+	SubjectID string
+	From      time.Time
+	To        time.Time
+	AfterSeq  int64
+	Limit     int64
+}
+
+func (q Query) filter() bson.M {
+	filter := bson.M{}
+	if q.Type != "" {
+		filter["type"] = q.Type
+	}
+	if q.ActorID != "" {
+		filter["actor_id"] = q.ActorID
+	}
+	if q.SubjectID != "" {
+		filter["subject_id"] = q.SubjectID
+	}
+	if q.AfterSeq > 0 {
+		filter["_id"] = bson.M{"$gt": q.AfterSeq}
+	}
+	between := bson.M{}
+	if !q.From.IsZero() {
+		between["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		between["$lt"] = q.To
+	}
+	if len(between) > 0 {
+		filter["time"] = between
+	}
+	return filter
+}
+
+func (l *Log) Find(ctx context.Context, q Query) ([]Record, error) {
+	if q.Limit <= 0 || q.Limit > maxQueryLimit {
+		q.Limit = maxQueryLimit
+	}
+	cursor, err := l.collection().Find(ctx, q.filter(),
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(q.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	records := []Record{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,156 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/audit"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/router"
+	"github.com/sing3demons/auth-service/store"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newLog(t *testing.T) (*audit.Log, store.Collection) {
+	db := store.NewMemoryStore()
+	return audit.NewLog(db, audit.Config{}), db.Database(audit.DefaultDatabase).Collection(audit.DefaultCollection)
+}
+
+func seed(t *testing.T, log *audit.Log) []audit.Record {
+	ctx := audit.WithSource(mlog.WithRequestID(context.Background(), "req-1"), audit.Source{IP: "10.0.0.1", UserAgent: "curl/8"})
+	events := []audit.Event{
+		{Type: audit.LoginFailed, Reason: "invalid_password", ActorID: "user-1", Details: map[string]string{"identifier": "a@example.com"}},
+		{Type: audit.LoginSucceeded, ActorID: "user-1"},
+		{Type: audit.RoleGranted, ActorID: "admin-1", SubjectID: "user-1", Details: map[string]string{"role": "admin"}},
+		{Type: audit.TokenRefreshed, ActorID: "user-1"},
+	}
+	var records []audit.Record
+	for _, event := range events {
+		record, err := log.Append(ctx, event)
+		assert.NoError(t, err)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAppend(t *testing.T) {
+	ctx := context.Background()
+	log, _ := newLog(t)
+	records := seed(t, log)
+
+	assert.Equal(t, int64(1), records[0].Seq)
+	assert.Empty(t, records[0].PrevHash)
+	for i := 1; i < len(records); i++ {
+		assert.Equal(t, records[i-1].Seq+1, records[i].Seq)
+		assert.Equal(t, records[i-1].Hash, records[i].PrevHash)
+	}
+	assert.Equal(t, "10.0.0.1", records[0].IP)
+	assert.Equal(t, "curl/8", records[0].UserAgent)
+	assert.Equal(t, "req-1", records[0].RequestID)
+	assert.Equal(t, "user-1", records[1].SubjectID, "subject defaults to the actor")
+
+	last, err := log.Last(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, records[3].Hash, last.Hash)
+	assert.Equal(t, last.Hash, last.ComputeHash(), "the hash survives a round trip through the store")
+
+	found, err := log.Find(ctx, audit.Query{SubjectID: "user-1", Type: audit.LoginSucceeded})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	found, err = log.Find(ctx, audit.Query{ActorID: "user-1", AfterSeq: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2}, seqs(found))
+
+	found, err = log.Find(ctx, audit.Query{From: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func seqs(records []audit.Record) []int64 {
+	out := []int64{}
+	for _, r := range records {
+		out = append(out, r.Seq)
+	}
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("intact", func(t *testing.T) {
+		log, _ := newLog(t)
+		records := seed(t, log)
+		report, err := log.Verify(ctx)
+		assert.NoError(t, err)
+		assert.Nil(t, report.Problem)
+		assert.Equal(t, int64(4), report.Checked)
+		assert.Equal(t, records[3].Hash, report.Last.Hash)
+	})
+
+	t.Run("edited", func(t *testing.T) {
+		log, events := newLog(t)
+		seed(t, log)
+		_, err := events.UpdateOne(ctx, bson.M{"_id": int64(2)}, bson.M{"$set": bson.M{"ip": "192.168.1.9"}})
+		assert.NoError(t, err)
+
+		report, err := log.Verify(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, &audit.Problem{Seq: 2, Reason: "contents do not match its hash"}, report.Problem)
+		assert.Equal(t, int64(1), report.Checked)
+	})
+
+	t.Run("rehashed", func(t *testing.T) {
+		log, events := newLog(t)
+		records := seed(t, log)
+		forged := records[1]
+		forged.ActorID = "user-2"
+		_, err := events.UpdateOne(ctx, bson.M{"_id": int64(2)}, bson.M{"$set": bson.M{"actor_id": "user-2", "hash": forged.ComputeHash()}})
+		assert.NoError(t, err)
+
+		report, err := log.Verify(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, &audit.Problem{Seq: 3, Reason: "does not link to the record before it"}, report.Problem)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		log, events := newLog(t)
+		seed(t, log)
+		_, err := events.DeleteOne(ctx, bson.M{"_id": int64(3)})
+		assert.NoError(t, err)
+
+		report, err := log.Verify(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), report.Problem.Seq)
+	})
+}
+
+func TestList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log, _ := newLog(t)
+	seed(t, log)
+
+	r := router.New()
+	audit.Register(r, log)
+	engine := r.(http.Handler)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/audit/events?actor=user-1&type=login.failed", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Data []audit.Record `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, []int64{1}, seqs(body.Data))
+	assert.Equal(t, "invalid_password", body.Data[0].Reason)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/audit/events?from=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
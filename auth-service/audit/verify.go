@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+)
+
+// Problem describes the first place the chain breaks.
+type Problem struct {
+	Seq    int64  `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+func (p Problem) Error() string {
+	return fmt.Sprintf("audit: record %d: %s", p.Seq, p.Reason)
+}
+
+type Report struct {
+	Checked int64    `json:"checked"`
+	Last    *Record  `json:"last,omitempty"`
+	Problem *Problem `json:"problem,omitempty"`
+}
+
+// Verify walks the whole log in order and recomputes every hash. It stops at
+// the first record that was edited, is missing, or does not link to the one
+// before it. Dropping records from the tail leaves a valid chain; compare
+// Last with a previously saved copy to catch that.
+func (l *Log) Verify(ctx context.Context) (Report, error) {
+	var report Report
+	var prev *Record
+	for {
+		after := int64(0)
+		if prev != nil {
+			after = prev.Seq
+		}
+		records, err := l.Find(ctx, Query{AfterSeq: after})
+		if err != nil {
+			return report, err
+		}
+		if len(records) == 0 {
+			return report, nil
+		}
+		for i := range records {
+			record := &records[i]
+			if problem := check(prev, record); problem != nil {
+				report.Problem = problem
+				return report, nil
+			}
+			report.Checked++
+			report.Last, prev = record, record
+		}
+	}
+}
+
+func check(prev, record *Record) *Problem {
+	wantSeq, wantPrev := int64(1), ""
+	if prev != nil {
+		wantSeq, wantPrev = prev.Seq+1, prev.Hash
+	}
+	switch {
+	case record.Seq != wantSeq:
+		return &Problem{Seq: wantSeq, Reason: fmt.Sprintf("missing; next record is %d", record.Seq)}
+	case record.PrevHash != wantPrev:
+		return &Problem{Seq: record.Seq, Reason: "does not link to the record before it"}
+	case record.Hash != record.ComputeHash():
+		return &Problem{Seq: record.Seq, Reason: "contents do not match its hash"}
+	}
+	return nil
+}
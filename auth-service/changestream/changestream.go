@@ -0,0 +1,258 @@
+// Package changestream tails a Mongo collection and hands every change to
+// local subscribers, so each replica can react to writes made by the
+// others. The resume token of the last handled change is saved, letting a
+// restarted consumer carry on where it stopped.
+package changestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sing3demons/auth-service/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	Insert  = "insert"
+	Update  = "update"
+	Replace = "replace"
+	Delete  = "delete"
+)
+
+// errHistoryLost is the server code for a resume token that has fallen off
+// the oplog.
+const errHistoryLost = 286
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Name keys the saved resume token. Every replica needs its own.
+	Name string `yaml:"name"`
+	// Database and Collection name the watched collection.
+	Database   string `yaml:"-"`
+	Collection string `yaml:"-"`
+	// PreImages asks for the document before each change. The collection
+	// needs changeStreamPreAndPostImages enabled (MongoDB 6.0 or later);
+	// without it a delete only carries the document's _id.
+	PreImages  bool          `yaml:"pre_images"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Database:   "auth",
+		Collection: "users",
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+	}
+}
+
+// Change is one change event. FullDocument is the document after an
+// insert, replace or update; FullDocumentBeforeChange is only set when the
+// collection records pre-images.
+type Change struct {
+	ID                       bson.Raw            `bson:"_id"`
+	Operation                string              `bson:"operationType"`
+	ClusterTime              primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey              bson.Raw            `bson:"documentKey"`
+	FullDocument             bson.Raw            `bson:"fullDocument,omitempty"`
+	FullDocumentBeforeChange bson.Raw            `bson:"fullDocumentBeforeChange,omitempty"`
+	UpdateDescription        struct {
+		UpdatedFields bson.Raw `bson:"updatedFields,omitempty"`
+		RemovedFields []string `bson:"removedFields,omitempty"`
+	} `bson:"updateDescription,omitempty"`
+}
+
+// Lookup returns the string field key of the document after the change,
+// or before it when the document is gone.
+func (c Change) Lookup(key string) string {
+	for _, doc := range []bson.Raw{c.FullDocument, c.FullDocumentBeforeChange} {
+		if len(doc) == 0 {
+			continue
+		}
+		if value, ok := doc.Lookup(key).StringValueOK(); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+type Handler interface {
+	HandleChange(ctx context.Context, change Change) error
+}
+
+type HandlerFunc func(ctx context.Context, change Change) error
+
+func (f HandlerFunc) HandleChange(ctx context.Context, change Change) error {
+	return f(ctx, change)
+}
+
+// Stream is the part of *mongo.ChangeStream the consumer reads.
+type Stream interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Opener starts a change stream; store.Store.Watch wrapped by Watch is one.
+type Opener func(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (Stream, error)
+
+// Watch opens change streams on client.
+func Watch(client store.Store) Opener {
+	return func(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (Stream, error) {
+		stream, err := client.Watch(ctx, pipeline, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+}
+
+// Consumer tails one collection and fans each change out to its
+// subscribers in the order they subscribed.
+type Consumer struct {
+	open   Opener
+	tokens TokenStore
+	config Config
+	logger *slog.Logger
+
+	mu          sync.RWMutex
+	subscribers []Handler
+}
+
+func NewConsumer(open Opener, tokens TokenStore, config Config, logger *slog.Logger) *Consumer {
+	defaults := DefaultConfig()
+	if config.Database == "" {
+		config.Database = defaults.Database
+	}
+	if config.Collection == "" {
+		config.Collection = defaults.Collection
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaults.Backoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	return &Consumer{open: open, tokens: tokens, config: config, logger: logger}
+}
+
+func (c *Consumer) Subscribe(handlers ...Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, handlers...)
+}
+
+// Run tails the collection until ctx is done, reopening the stream with
+// backoff when it fails. It only returns early when the store cannot
+// watch at all.
+func (c *Consumer) Run(ctx context.Context) error {
+	backoff := c.config.Backoff
+	for {
+		handled, err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, store.ErrChangeStreamNotSupported) {
+			return err
+		}
+		if handled > 0 {
+			backoff = c.config.Backoff
+		}
+		c.logger.Error("change stream failed", "collection", c.config.Collection, "retry_in", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.config.MaxBackoff)
+	}
+}
+
+// consume reads one stream until it fails and returns how many changes it
+// handled.
+func (c *Consumer) consume(ctx context.Context) (int, error) {
+	token, err := c.tokens.Load(ctx, c.config.Name)
+	if err != nil {
+		return 0, err
+	}
+	stream, err := c.openStream(ctx, token)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == errHistoryLost {
+		// changes were missed; nothing can replay them, so start from now
+		c.logger.Warn("change stream resume token expired, starting from now", "collection", c.config.Collection)
+		if err := c.tokens.Save(ctx, c.config.Name, nil); err != nil {
+			return 0, err
+		}
+		stream, err = c.openStream(ctx, nil)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close(context.Background())
+
+	handled := 0
+	for stream.Next(ctx) {
+		var change Change
+		if err := stream.Decode(&change); err != nil {
+			return handled, fmt.Errorf("changestream: %w", err)
+		}
+		// the token is only saved once every subscriber has handled the
+		// change; otherwise the stream reopens before it and tries again
+		if err := c.dispatch(ctx, change); err != nil {
+			return handled, err
+		}
+		if err := c.tokens.Save(ctx, c.config.Name, change.ID); err != nil {
+			return handled, err
+		}
+		handled++
+	}
+	if err := stream.Err(); err != nil {
+		return handled, fmt.Errorf("changestream: %w", err)
+	}
+	return handled, errors.New("changestream: stream closed")
+}
+
+func (c *Consumer) openStream(ctx context.Context, token bson.Raw) (Stream, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"ns.db":         c.config.Database,
+		"ns.coll":       c.config.Collection,
+		"operationType": bson.M{"$in": bson.A{Insert, Update, Replace, Delete}},
+	}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if c.config.PreImages {
+		opts.SetFullDocumentBeforeChange(options.WhenAvailable)
+	}
+	if len(token) > 0 {
+		opts.SetResumeAfter(token)
+	}
+	stream, err := c.open(ctx, pipeline, opts)
+	if err != nil {
+		return nil, fmt.Errorf("changestream: %w", err)
+	}
+	return stream, nil
+}
+
+// dispatch hands change to every subscriber, even after one fails, and
+// returns their errors. Subscribers see a change again when it is retried,
+// so they must tolerate duplicates.
+func (c *Consumer) dispatch(ctx context.Context, change Change) error {
+	c.mu.RLock()
+	subscribers := c.subscribers
+	c.mu.RUnlock()
+	var errs []error
+	for _, subscriber := range subscribers {
+		if err := subscriber.HandleChange(ctx, change); err != nil {
+			errs = append(errs, fmt.Errorf("changestream: %s handler: %w", change.Operation, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,142 @@
+package changestream_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/changestream"
+	"github.com/sing3demons/auth-service/store"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeStream yields docs and then stops the consumer.
+type fakeStream struct {
+	docs []bson.Raw
+	stop context.CancelFunc
+	next bson.Raw
+}
+
+func (s *fakeStream) Next(ctx context.Context) bool {
+	if len(s.docs) == 0 {
+		s.stop()
+		return false
+	}
+	s.next, s.docs = s.docs[0], s.docs[1:]
+	return true
+}
+
+func (s *fakeStream) Decode(val interface{}) error    { return bson.Unmarshal(s.next, val) }
+func (s *fakeStream) Err() error                      { return nil }
+func (s *fakeStream) Close(ctx context.Context) error { return nil }
+
+func change(t *testing.T, token, operation string, doc bson.D) bson.Raw {
+	event := bson.D{{Key: "_id", Value: bson.D{{Key: "_data", Value: token}}}, {Key: "operationType", Value: operation}}
+	if doc != nil {
+		event = append(event, bson.E{Key: "fullDocument", Value: doc})
+	}
+	raw, err := bson.Marshal(event)
+	assert.NoError(t, err)
+	return raw
+}
+
+// opener serves one stream per call from streams and records the resume
+// token each call asked for.
+func opener(streams []*fakeStream, resumed *[]bson.Raw) changestream.Opener {
+	return func(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (changestream.Stream, error) {
+		token, _ := opts[0].ResumeAfter.(bson.Raw)
+		*resumed = append(*resumed, token)
+		stream := streams[0]
+		streams = streams[1:]
+		return stream, nil
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	tokens := changestream.NewMongoTokenStore(store.NewMemoryStore(), changestream.TokenConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	first := &fakeStream{stop: cancel, docs: []bson.Raw{
+		change(t, "1", changestream.Insert, bson.D{{Key: "id", Value: "u1"}}),
+		change(t, "2", changestream.Update, bson.D{{Key: "id", Value: "u2"}}),
+		change(t, "3", changestream.Delete, nil),
+	}}
+	retry := &fakeStream{stop: cancel, docs: []bson.Raw{
+		change(t, "2", changestream.Update, bson.D{{Key: "id", Value: "u2"}}),
+		change(t, "3", changestream.Delete, nil),
+	}}
+	var resumed []bson.Raw
+	config := changestream.Config{Name: "replica-1", Backoff: time.Millisecond}
+	consumer := changestream.NewConsumer(opener([]*fakeStream{first, retry}, &resumed), tokens, config, slog.Default())
+
+	var seen []string
+	failed := false
+	consumer.Subscribe(
+		changestream.HandlerFunc(func(ctx context.Context, change changestream.Change) error {
+			if change.Lookup("id") == "u2" && !failed {
+				failed = true
+				return errors.New("cache down")
+			}
+			return nil
+		}),
+		changestream.HandlerFunc(func(ctx context.Context, change changestream.Change) error {
+			seen = append(seen, change.Operation+":"+change.Lookup("id"))
+			return nil
+		}),
+	)
+	assert.NoError(t, consumer.Run(ctx))
+	assert.Equal(t, []string{"insert:u1", "update:u2", "update:u2", "delete:"}, seen, "a failed change is handed out again")
+	assert.Len(t, resumed, 2)
+	assert.Nil(t, resumed[0])
+	assert.Equal(t, "1", resumed[1].Lookup("_data").StringValue(), "the failed change is retried from the last handled one")
+
+	saved, err := tokens.Load(context.TODO(), "replica-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", saved.Lookup("_data").StringValue())
+
+	// a restarted consumer resumes after the last change
+	ctx, cancel = context.WithCancel(context.Background())
+	consumer = changestream.NewConsumer(opener([]*fakeStream{{stop: cancel}}, &resumed), tokens, changestream.Config{Name: "replica-1"}, slog.Default())
+	assert.NoError(t, consumer.Run(ctx))
+	assert.Equal(t, "3", resumed[2].Lookup("_data").StringValue())
+
+	other, err := tokens.Load(context.TODO(), "replica-2")
+	assert.NoError(t, err)
+	assert.Nil(t, other, "each replica keeps its own token")
+}
+
+func TestConsumerHistoryLost(t *testing.T) {
+	tokens := changestream.NewMongoTokenStore(store.NewMemoryStore(), changestream.TokenConfig{})
+	stale, _ := bson.Marshal(bson.D{{Key: "_data", Value: "old"}})
+	assert.NoError(t, tokens.Save(context.TODO(), "replica-1", stale))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var resumed []bson.Raw
+	open := func(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (changestream.Stream, error) {
+		token, _ := opts[0].ResumeAfter.(bson.Raw)
+		resumed = append(resumed, token)
+		if token != nil {
+			return nil, mongo.CommandError{Code: 286, Name: "ChangeStreamHistoryLost"}
+		}
+		return &fakeStream{stop: cancel}, nil
+	}
+	consumer := changestream.NewConsumer(open, tokens, changestream.Config{Name: "replica-1"}, slog.Default())
+	assert.NoError(t, consumer.Run(ctx))
+	assert.Len(t, resumed, 2)
+	assert.Nil(t, resumed[1], "an expired token restarts from now")
+
+	saved, err := tokens.Load(context.TODO(), "replica-1")
+	assert.NoError(t, err)
+	assert.Nil(t, saved)
+}
+
+func TestConsumerNotSupported(t *testing.T) {
+	db := store.NewMemoryStore()
+	consumer := changestream.NewConsumer(changestream.Watch(db),
+		changestream.NewMongoTokenStore(db, changestream.TokenConfig{}), changestream.Config{Name: "replica-1"}, slog.Default())
+	assert.ErrorIs(t, consumer.Run(context.TODO()), store.ErrChangeStreamNotSupported)
+}
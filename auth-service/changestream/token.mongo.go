@@ -0,0 +1,76 @@
+package changestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sing3demons/auth-service/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const DefaultTokenCollection = "change_stream_tokens"
+
+// TokenStore keeps the resume token of each consumer by name. A nil token
+// means start from the current end of the stream.
+type TokenStore interface {
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+type TokenConfig struct {
+	Database   string
+	Collection string
+}
+
+type mongoTokenStore struct {
+	store  store.Store
+	config TokenConfig
+}
+
+type savedToken struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func NewMongoTokenStore(client store.Store, config TokenConfig) TokenStore {
+	if config.Database == "" {
+		config.Database = DefaultConfig().Database
+	}
+	if config.Collection == "" {
+		config.Collection = DefaultTokenCollection
+	}
+	return &mongoTokenStore{store: client, config: config}
+}
+
+func (s *mongoTokenStore) collection() store.Collection {
+	return s.store.Database(s.config.Database).Collection(s.config.Collection)
+}
+
+func (s *mongoTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var saved savedToken
+	err := s.collection().FindOne(ctx, bson.M{"_id": name}).Decode(&saved)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("changestream: load resume token: %w", err)
+	}
+	return saved.Token, nil
+}
+
+func (s *mongoTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	update := bson.M{"$set": bson.M{"token": token, "updated_at": time.Now().UTC()}}
+	if len(token) == 0 {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now().UTC()}, "$unset": bson.M{"token": ""}}
+	}
+	_, err := s.collection().UpdateOne(ctx, bson.M{"_id": name}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("changestream: save resume token: %w", err)
+	}
+	return nil
+}
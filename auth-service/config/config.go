@@ -0,0 +1,575 @@
+// Package config loads the service configuration once at startup. Values
+// come from, in increasing order of precedence, the built-in defaults, an
+// optional YAML file, a .env file and the process environment.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/sing3demons/auth-service/audit"
+	"github.com/sing3demons/auth-service/changestream"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/sing3demons/auth-service/logger"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/outbox"
+	"github.com/sing3demons/auth-service/redis"
+	"github.com/sing3demons/auth-service/tracing"
+	"github.com/sing3demons/auth-service/user"
+	"github.com/sing3demons/auth-service/webhook"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// File is the YAML file the configuration was read from, if any.
+	File string `yaml:"-"`
+
+	Env      string `yaml:"env"`
+	Port     string `yaml:"port"`
+	HostURL  string `yaml:"host_url"`
+	LogLevel string `yaml:"log_level"`
+	// TrustedProxies lists the proxies, as IPs or CIDRs, whose
+	// X-Forwarded-For header is believed. With none the client IP is the
+	// connection's address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// ServiceName tags every log line.
+	ServiceName string `yaml:"service_name"`
+	// LogSinks lists where logs are written. It is only read from YAML.
+	LogSinks []logger.SinkConfig `yaml:"log_sinks"`
+
+	Store     Store                    `yaml:"store"`
+	Redis     Redis                    `yaml:"redis"`
+	Keys      Keys                     `yaml:"keys"`
+	Tokens    user.TokenConfig         `yaml:"tokens"`
+	Tracing   tracing.Config           `yaml:"tracing"`
+	AccessLog mlog.AccessLogConfig     `yaml:"access_log"`
+	Events    events.Config            `yaml:"events"`
+	Outbox    outbox.RelayConfig       `yaml:"outbox"`
+	Webhooks  webhook.DispatcherConfig `yaml:"webhooks"`
+	// ChangeStream tails the users collection; it needs a replica set.
+	ChangeStream changestream.Config `yaml:"change_stream"`
+	// Redact lists the log redaction rules. Env LOG_REDACT_KEYS appends key
+	// rules as pattern=action pairs, e.g. "ssn=drop,phone=hash".
+	Redact []logger.Rule `yaml:"redact"`
+}
+
+// Store selects the user store. Driver is mongo, memory, sqlite or postgres.
+type Store struct {
+	Driver                     string        `yaml:"driver"`
+	MongoURI                   Secret        `yaml:"mongo_uri"`
+	MongoDatabase              string        `yaml:"mongo_database"`
+	UsersCollection            string        `yaml:"users_collection"`
+	ProfileLanguagesCollection string        `yaml:"profile_languages_collection"`
+	AuditCollection            string        `yaml:"audit_collection"`
+	OutboxCollection           string        `yaml:"outbox_collection"`
+	WebhookCollection          string        `yaml:"webhook_collection"`
+	WebhookDeliveryCollection  string        `yaml:"webhook_delivery_collection"`
+	ResumeTokenCollection      string        `yaml:"resume_token_collection"`
+	SQLDSN                     Secret        `yaml:"sql_dsn"`
+	CacheTTL                   time.Duration `yaml:"cache_ttl"`
+}
+
+// Redis selects the token store. Driver is redis or memory.
+type Redis struct {
+	Driver           string `yaml:"driver"`
+	URI              Secret `yaml:"uri"`
+	Username         string `yaml:"username"`
+	Password         Secret `yaml:"password"`
+	SentinelPassword Secret `yaml:"sentinel_password"`
+}
+
+// Keys selects where signing keys come from: env reads base64 PEM from the
+// environment, file reads PEM files from Dir, dir serves versioned keys from
+// Dir and kms signs with the KMS keys named by KMS.
+type Keys struct {
+	Source     string          `yaml:"source"`
+	Dir        string          `yaml:"dir"`
+	KMS        KMSKeys         `yaml:"kms"`
+	Algorithms keys.Algorithms `yaml:"algorithms"`
+}
+
+// KMSKeys names the KMS keys that sign access and refresh tokens.
+type KMSKeys struct {
+	AccessKeyID  string `yaml:"access_key_id"`
+	RefreshKeyID string `yaml:"refresh_key_id"`
+}
+
+func Default() *Config {
+	return &Config{
+		Env:          "development",
+		Port:         "8080",
+		LogLevel:     "debug",
+		ServiceName:  "auth-service",
+		LogSinks:     logger.DefaultSinks(),
+		Store:        Store{Driver: "mongo", CacheTTL: 5 * time.Minute},
+		Redis:        Redis{Driver: "redis"},
+		Keys:         Keys{Source: "env", Algorithms: keys.DefaultAlgorithms()},
+		Tokens:       user.DefaultTokenConfig(),
+		Tracing:      tracing.Config{Exporter: tracing.ExporterNone, ServiceName: "auth-service", SampleRatio: 1},
+		AccessLog:    mlog.DefaultAccessLogConfig(),
+		Events:       events.Config{Publisher: events.PublisherNone, Topic: events.DefaultTopic, Format: events.FormatJSON, Source: events.DefaultSource, Delivery: events.DeliveryDirect},
+		Outbox:       outbox.DefaultRelayConfig(),
+		Webhooks:     webhook.DefaultDispatcherConfig(),
+		ChangeStream: changestream.DefaultConfig(),
+		Redact:       logger.DefaultRedactRules(),
+	}
+}
+
+// Lookup returns the value of an environment variable and whether it is set.
+type Lookup func(name string) (string, bool)
+
+// Load reads .env.dev outside production and the YAML file named by
+// CONFIG_FILE, if any, then applies the environment on top. The .env file is
+// loaded into the process environment so keys.EnvSource sees it too; it never
+// overrides variables that are already set.
+func Load() (*Config, error) {
+	file, err := readEnvFile()
+	if err != nil {
+		return nil, err
+	}
+	dotenv.mu.Lock()
+	for name, value := range file {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		os.Setenv(name, value)
+		dotenv.names[name] = true
+	}
+	dotenv.mu.Unlock()
+	return LoadFrom(os.LookupEnv, os.Getenv("CONFIG_FILE"))
+}
+
+// dotenv remembers which variables Load took from .env.dev rather than the
+// real environment.
+var dotenv = struct {
+	mu    sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// Reread is Load for a running service, with the same precedence: the real
+// environment, then .env.dev, then the YAML file. Variables that came from
+// .env.dev are read from the file again so edits take effect, but the process
+// environment is left alone, so keys.EnvSource keeps the keys it started with.
+func Reread() (*Config, error) {
+	file, err := readEnvFile()
+	if err != nil {
+		return nil, err
+	}
+	dotenv.mu.Lock()
+	defer dotenv.mu.Unlock()
+	lookup := func(name string) (string, bool) {
+		if !dotenv.names[name] {
+			if value, ok := os.LookupEnv(name); ok {
+				return value, true
+			}
+		}
+		value, ok := file[name]
+		return value, ok
+	}
+	return LoadFrom(lookup, os.Getenv("CONFIG_FILE"))
+}
+
+// readEnvFile parses .env.dev outside production. A missing file is empty.
+func readEnvFile() (map[string]string, error) {
+	if os.Getenv("ENV") == "production" {
+		return nil, nil
+	}
+	file, err := godotenv.Read(".env.dev")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return file, nil
+}
+
+// LoadFrom builds a Config from the YAML file, which may be empty, and the
+// variables returned by lookup, and validates it.
+func LoadFrom(lookup Lookup, file string) (*Config, error) {
+	config := Default()
+	config.File = file
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", file, err)
+		}
+	}
+	if err := config.applyEnv(lookup); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) applyEnv(lookup Lookup) error {
+	values := map[string]*string{
+		"ENV":                                &c.Env,
+		"PORT":                               &c.Port,
+		"HOST_URL":                           &c.HostURL,
+		"LOG_LEVEL":                          &c.LogLevel,
+		"SERVICE_NAME":                       &c.ServiceName,
+		"STORE":                              &c.Store.Driver,
+		"MONGO_URI":                          (*string)(&c.Store.MongoURI),
+		"MONGO_DATABASE":                     &c.Store.MongoDatabase,
+		"MONGO_USERS_COLLECTION":             &c.Store.UsersCollection,
+		"MONGO_PROFILE_LANGUAGES_COLLECTION": &c.Store.ProfileLanguagesCollection,
+		"MONGO_AUDIT_COLLECTION":             &c.Store.AuditCollection,
+		"MONGO_OUTBOX_COLLECTION":            &c.Store.OutboxCollection,
+		"MONGO_WEBHOOK_COLLECTION":           &c.Store.WebhookCollection,
+		"MONGO_WEBHOOK_DELIVERY_COLLECTION":  &c.Store.WebhookDeliveryCollection,
+		"MONGO_RESUME_TOKEN_COLLECTION":      &c.Store.ResumeTokenCollection,
+		"CHANGE_STREAM_NAME":                 &c.ChangeStream.Name,
+		"SQL_DSN":                            (*string)(&c.Store.SQLDSN),
+		"REDIS":                              &c.Redis.Driver,
+		"REDIS_URI":                          (*string)(&c.Redis.URI),
+		"REDIS_USERNAME":                     &c.Redis.Username,
+		"REDIS_PASSWORD":                     (*string)(&c.Redis.Password),
+		"REDIS_SENTINEL_PASSWORD":            (*string)(&c.Redis.SentinelPassword),
+		"KEY_SOURCE":                         &c.Keys.Source,
+		"KEY_DIR":                            &c.Keys.Dir,
+		"KMS_ACCESS_KEY_ID":                  &c.Keys.KMS.AccessKeyID,
+		"KMS_REFRESH_KEY_ID":                 &c.Keys.KMS.RefreshKeyID,
+		"ACCESS_TOKEN_ALG":                   &c.Keys.Algorithms.Access,
+		"REFRESH_TOKEN_ALG":                  &c.Keys.Algorithms.Refresh,
+		"ISSUER":                             &c.Tokens.Issuer,
+		"TOKEN_FORMAT":                       &c.Tokens.Format,
+		"OTEL_TRACES_EXPORTER":               &c.Tracing.Exporter,
+		"OTEL_EXPORTER_OTLP_ENDPOINT":        &c.Tracing.Endpoint,
+		"OTEL_SERVICE_NAME":                  &c.Tracing.ServiceName,
+		"EVENTS_PUBLISHER":                   &c.Events.Publisher,
+		"EVENTS_TOPIC":                       &c.Events.Topic,
+		"EVENTS_FORMAT":                      &c.Events.Format,
+		"EVENTS_SOURCE":                      &c.Events.Source,
+		"EVENTS_DELIVERY":                    &c.Events.Delivery,
+	}
+	for name, field := range values {
+		if value, ok := lookup(name); ok && value != "" {
+			*field = value
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"USER_CACHE_TTL":        &c.Store.CacheTTL,
+		"OUTBOX_INTERVAL":       &c.Outbox.Interval,
+		"OUTBOX_RETENTION":      &c.Outbox.Retention,
+		"WEBHOOK_TIMEOUT":       &c.Webhooks.Timeout,
+		"TOKEN_ACCESS_TTL":      &c.Tokens.Lifetimes.Access,
+		"TOKEN_REFRESH_TTL":     &c.Tokens.Lifetimes.Refresh,
+		"TOKEN_REMEMBER_ME_TTL": &c.Tokens.Lifetimes.RememberMe,
+		"TOKEN_IDLE_TIMEOUT":    &c.Tokens.Lifetimes.Idle,
+		"TOKEN_MAX_SESSION":     &c.Tokens.Lifetimes.MaxSession,
+	}
+	var errs []error
+	for name, field := range durations {
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid duration %q", name, value))
+			continue
+		}
+		*field = d
+	}
+
+	if value, ok := lookup("OTEL_TRACES_SAMPLER_ARG"); ok && value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG: invalid ratio %q", value))
+		}
+		c.Tracing.SampleRatio = ratio
+	}
+
+	if value, ok := lookup("ACCESS_LOG_SAMPLE_RATE"); ok && value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ACCESS_LOG_SAMPLE_RATE: invalid rate %q", value))
+		}
+		c.AccessLog.SampleRate = rate
+	}
+	if value, ok := lookup("CHANGE_STREAM_ENABLED"); ok && value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CHANGE_STREAM_ENABLED: invalid boolean %q", value))
+		}
+		c.ChangeStream.Enabled = enabled
+	}
+	if value, ok := lookup("CHANGE_STREAM_PRE_IMAGES"); ok && value != "" {
+		preImages, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CHANGE_STREAM_PRE_IMAGES: invalid boolean %q", value))
+		}
+		c.ChangeStream.PreImages = preImages
+	}
+	if value, ok := lookup("KAFKA_BROKERS"); ok && value != "" {
+		c.Events.Brokers = nil
+		for _, broker := range strings.Split(value, ",") {
+			if broker = strings.TrimSpace(broker); broker != "" {
+				c.Events.Brokers = append(c.Events.Brokers, broker)
+			}
+		}
+	}
+	if value, ok := lookup("TRUSTED_PROXIES"); ok && value != "" {
+		c.TrustedProxies = nil
+		for _, proxy := range strings.Split(value, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				c.TrustedProxies = append(c.TrustedProxies, proxy)
+			}
+		}
+	}
+	if value, ok := lookup("ACCESS_LOG_SKIP"); ok && value != "" {
+		c.AccessLog.Skip = nil
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				c.AccessLog.Skip = append(c.AccessLog.Skip, path)
+			}
+		}
+	}
+
+	if value, ok := lookup("LOG_REDACT_KEYS"); ok && value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			pattern, action, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				errs = append(errs, fmt.Errorf("LOG_REDACT_KEYS: expected pattern=action, got %q", pair))
+				continue
+			}
+			c.Redact = append(c.Redact, logger.Rule{Key: pattern, Action: logger.Action(action)})
+		}
+	}
+
+	// TOKEN_FORMAT_AUDIENCES is a comma separated list of audience=format
+	// pairs, TOKEN_AUDIENCES a comma separated list of further audiences and TOKEN_CLIENTS is JSON, e.g. {"mobile":{"refresh":"720h"}}.
+	if value, ok := lookup("TOKEN_FORMAT_AUDIENCES"); ok && value != "" {
+		c.Tokens.AudienceFormats = map[string]string{}
+		for _, pair := range strings.Split(value, ",") {
+			audience, format, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				errs = append(errs, fmt.Errorf("TOKEN_FORMAT_AUDIENCES: expected audience=format, got %q", pair))
+				continue
+			}
+			c.Tokens.AudienceFormats[audience] = format
+		}
+	}
+	if value, ok := lookup("TOKEN_AUDIENCES"); ok && value != "" {
+		c.Tokens.Audiences = nil
+		for _, audience := range strings.Split(value, ",") {
+			if audience = strings.TrimSpace(audience); audience != "" {
+				c.Tokens.Audiences = append(c.Tokens.Audiences, audience)
+			}
+		}
+	}
+	if value, ok := lookup("TOKEN_CLIENTS"); ok && value != "" {
+		c.Tokens.Clients = nil
+		if err := json.Unmarshal([]byte(value), &c.Tokens.Clients); err != nil {
+			errs = append(errs, fmt.Errorf("TOKEN_CLIENTS: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("PORT: invalid port %q", c.Port)
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			invalid("TRUSTED_PROXIES: invalid IP or CIDR %q", proxy)
+		}
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("LOG_LEVEL: must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	switch c.Store.Driver {
+	case "mongo":
+		if c.Store.MongoURI == "" {
+			invalid("MONGO_URI: required when STORE is mongo")
+		}
+	case "sqlite", "postgres":
+		if c.Store.SQLDSN == "" {
+			invalid("SQL_DSN: required when STORE is %s", c.Store.Driver)
+		}
+	case "memory":
+	default:
+		invalid("STORE: must be mongo, memory, sqlite or postgres, got %q", c.Store.Driver)
+	}
+	if c.Store.CacheTTL < 0 {
+		invalid("USER_CACHE_TTL: must not be negative")
+	}
+	if c.ChangeStream.Enabled && c.Store.Driver != "mongo" {
+		invalid("CHANGE_STREAM_ENABLED: needs STORE mongo, got %q", c.Store.Driver)
+	}
+	if c.ChangeStream.Enabled && !c.ChangeStream.PreImages {
+		// without pre-images a delete carries only the document _id, which
+		// cannot be traced back to the user it removed
+		invalid("CHANGE_STREAM_PRE_IMAGES: required when CHANGE_STREAM_ENABLED is set")
+	}
+
+	switch c.Redis.Driver {
+	case "redis":
+		if c.Redis.URI == "" {
+			invalid("REDIS_URI: required when REDIS is redis")
+		} else if _, err := c.Redis.Options(); err != nil {
+			invalid("REDIS_URI: %w", err)
+		}
+	case "memory":
+	default:
+		invalid("REDIS: must be redis or memory, got %q", c.Redis.Driver)
+	}
+
+	switch c.Keys.Source {
+	case "env":
+	case "file", "dir":
+		if c.Keys.Dir == "" {
+			invalid("KEY_DIR: required when KEY_SOURCE is %s", c.Keys.Source)
+		}
+	case "kms":
+		// only the in-memory KMS exists, whose keys die with the process
+		if c.Env == "production" {
+			invalid("KEY_SOURCE: kms is not available in production")
+		}
+		if c.Keys.KMS.AccessKeyID == "" || c.Keys.KMS.RefreshKeyID == "" {
+			invalid("KMS_ACCESS_KEY_ID, KMS_REFRESH_KEY_ID: required when KEY_SOURCE is kms")
+		}
+	default:
+		invalid("KEY_SOURCE: must be env, file, dir or kms, got %q", c.Keys.Source)
+	}
+	if err := c.Keys.Algorithms.Validate(); err != nil {
+		invalid("ACCESS_TOKEN_ALG/REFRESH_TOKEN_ALG: %w", err)
+	}
+
+	if err := c.Tokens.Validate(); err != nil {
+		invalid("tokens: %w", err)
+	}
+	// PASETO v4.public signs both tokens with Ed25519
+	if c.Keys.Algorithms.Access != keys.EdDSA || c.Keys.Algorithms.Refresh != keys.EdDSA {
+		if c.Tokens.Format == user.TokenFormatPaseto {
+			invalid("TOKEN_FORMAT: paseto needs ACCESS_TOKEN_ALG and REFRESH_TOKEN_ALG to be %s", keys.EdDSA)
+		}
+		for audience, format := range c.Tokens.AudienceFormats {
+			if format == user.TokenFormatPaseto {
+				invalid("TOKEN_FORMAT_AUDIENCES: paseto for %s needs ACCESS_TOKEN_ALG and REFRESH_TOKEN_ALG to be %s", audience, keys.EdDSA)
+			}
+		}
+	}
+
+	if err := logger.ValidateSinks(c.LogSinks); err != nil {
+		invalid("log_sinks: %w", err)
+	}
+	if err := logger.ValidateRules(c.Redact); err != nil {
+		invalid("LOG_REDACT_KEYS: %w", err)
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		invalid("OTEL_TRACES_EXPORTER: must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	}
+	if err := c.Events.Validate(); err != nil {
+		invalid("EVENTS_PUBLISHER/KAFKA_BROKERS/EVENTS_FORMAT/EVENTS_DELIVERY: %w", err)
+	}
+	if c.AccessLog.SampleRate < 0 || c.AccessLog.SampleRate > 1 {
+		invalid("ACCESS_LOG_SAMPLE_RATE: must be between 0 and 1, got %v", c.AccessLog.SampleRate)
+	}
+	if c.Tracing.SampleRatio <= 0 || c.Tracing.SampleRatio > 1 {
+		invalid("OTEL_TRACES_SAMPLER_ARG: must be in (0, 1], got %v", c.Tracing.SampleRatio)
+	}
+	return errors.Join(errs...)
+}
+
+// Level is LogLevel as a slog level.
+func (c *Config) Level() slog.Level {
+	switch c.LogLevel {
+	case "info":
+		return slog.LevelInfo
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// Options parses URI and applies the credentials set outside it, so secrets
+// can be kept out of the URI.
+func (r Redis) Options() (redis.Options, error) {
+	o, err := redis.ParseURI(string(r.URI))
+	if err != nil {
+		return redis.Options{}, err
+	}
+	if r.Username != "" {
+		o.Username = r.Username
+	}
+	if r.Password != "" {
+		o.Password = string(r.Password)
+	}
+	if r.SentinelPassword != "" {
+		o.SentinelPassword = string(r.SentinelPassword)
+	}
+	return o, nil
+}
+
+func (s Store) MongoRepositoryConfig() user.MongoRepositoryConfig {
+	return user.MongoRepositoryConfig{
+		Database:         s.MongoDatabase,
+		Users:            s.UsersCollection,
+		ProfileLanguages: s.ProfileLanguagesCollection,
+	}
+}
+
+func (s Store) AuditConfig() audit.Config {
+	return audit.Config{Database: s.MongoDatabase, Collection: s.AuditCollection}
+}
+
+func (s Store) OutboxConfig() outbox.Config {
+	return outbox.Config{Database: s.MongoDatabase, Collection: s.OutboxCollection}
+}
+
+func (s Store) ResumeTokenConfig() changestream.TokenConfig {
+	return changestream.TokenConfig{Database: s.MongoDatabase, Collection: s.ResumeTokenCollection}
+}
+
+// ChangeStreamConfig points the change stream at the users collection the
+// repository writes to.
+func (c *Config) ChangeStreamConfig() changestream.Config {
+	config := c.ChangeStream
+	if c.Store.MongoDatabase != "" {
+		config.Database = c.Store.MongoDatabase
+	}
+	if c.Store.UsersCollection != "" {
+		config.Collection = c.Store.UsersCollection
+	}
+	return config
+}
+
+func (s Store) WebhookConfig() webhook.Config {
+	return webhook.Config{Database: s.MongoDatabase, Subscriptions: s.WebhookCollection, Deliveries: s.WebhookDeliveryCollection}
+}
+
+// String renders the configuration with secrets redacted.
+func (c *Config) String() string {
+	return fmt.Sprintf("%+v", *c)
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reloadable lists the top-level fields that may change while the service
+// runs. Changes to any other field are logged and ignored until restart.
+var reloadable = map[string]bool{
+	"LogLevel": true,
+	"Tokens":   true,
+}
+
+// Change is one field that differs between two configurations. Secrets are
+// redacted in Old and New.
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Diff lists the fields that differ between old and new, by dotted path.
+func Diff(old, new *Config) []Change {
+	return diff("", reflect.ValueOf(*old), reflect.ValueOf(*new))
+}
+
+func diff(path string, old, new reflect.Value) []Change {
+	if old.Kind() == reflect.Struct {
+		var changes []Change
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if path != "" {
+				name = path + "." + name
+			}
+			changes = append(changes, diff(name, old.Field(i), new.Field(i))...)
+		}
+		return changes
+	}
+	if reflect.DeepEqual(old.Interface(), new.Interface()) {
+		return nil
+	}
+	return []Change{{path, fmt.Sprint(old.Interface()), fmt.Sprint(new.Interface())}}
+}
+
+// Reloader re-reads the configuration on SIGHUP and when its YAML file
+// changes, and passes the result to the functions registered with OnReload.
+// Only the reloadable fields are taken from the new configuration. The
+// environment overrides the YAML file on reload as it does at startup, so a
+// field set in the environment is only reloaded from .env.dev.
+type Reloader struct {
+	load   func() (*Config, error)
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	current *Config
+	apply   []func(*Config)
+}
+
+func NewReloader(current *Config, load func() (*Config, error), logger *slog.Logger) *Reloader {
+	return &Reloader{load: load, logger: logger, current: current}
+}
+
+// OnReload registers fn to be called with every configuration that has
+// reloadable changes.
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apply = append(r.apply, fn)
+}
+
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads and validates the configuration and applies its reloadable
+// changes. An invalid configuration is rejected as a whole and the current
+// one stays in place.
+func (r *Reloader) Reload() ([]Change, error) {
+	loaded, err := r.load()
+	if err != nil {
+		r.logger.Error("config reload rejected", "error", err.Error())
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := *r.current
+	var applied []Change
+	for _, change := range Diff(r.current, loaded) {
+		field, _, _ := strings.Cut(change.Field, ".")
+		if !reloadable[field] {
+			r.logger.Warn("config change requires a restart", "field", change.Field, "old", change.Old, "new", change.New)
+			continue
+		}
+		applied = append(applied, change)
+		r.logger.Info("config changed", "field", change.Field, "old", change.Old, "new", change.New)
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+
+	next.LogLevel = loaded.LogLevel
+	next.Tokens = loaded.Tokens
+	r.current = &next
+	for _, fn := range r.apply {
+		fn(r.current)
+	}
+	return applied, nil
+}
+
+// Watch reloads on SIGHUP, and when the YAML file's modification time
+// changes, checked every interval. It returns when ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	file := r.Current().File
+	modified := modTime(file)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("config reload requested by SIGHUP")
+		case <-ticker.C:
+			if file == "" {
+				continue
+			}
+			t := modTime(file)
+			if t.Equal(modified) {
+				continue
+			}
+			modified = t
+			r.logger.Info("config file changed", "file", file)
+		}
+		// Reload logs its own errors
+		r.Reload()
+	}
+}
+
+func modTime(file string) time.Time {
+	if file == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
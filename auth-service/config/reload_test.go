@@ -0,0 +1,136 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, file, content string) {
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+}
+
+func newReloader(t *testing.T, file string, logs *bytes.Buffer) *config.Reloader {
+	load := func() (*config.Config, error) {
+		return config.LoadFrom(lookup(minimal()), file)
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	return config.NewReloader(cfg, load, slog.New(slog.NewTextHandler(logs, nil)))
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, file, "log_level: info\n")
+
+	var logs bytes.Buffer
+	reloader := newReloader(t, file, &logs)
+	var applied []*config.Config
+	reloader.OnReload(func(cfg *config.Config) {
+		applied = append(applied, cfg)
+	})
+
+	changes, err := reloader.Reload()
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Empty(t, applied)
+
+	writeFile(t, file, `
+port: "9090"
+log_level: warn
+store:
+  sql_dsn: postgres://admin:hunter2@db/auth
+tokens:
+  lifetimes:
+    access: 1m
+`)
+	changes, err = reloader.Reload()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []config.Change{
+		{Field: "LogLevel", Old: "info", New: "warn"},
+		{Field: "Tokens.Lifetimes.Access", Old: "5m0s", New: "1m0s"},
+	}, changes)
+
+	assert.Len(t, applied, 1)
+	assert.Equal(t, "warn", applied[0].LogLevel)
+	assert.Equal(t, time.Minute, applied[0].Tokens.Lifetimes.Access)
+	assert.Equal(t, "8080", applied[0].Port, "port needs a restart")
+	assert.Same(t, applied[0], reloader.Current())
+
+	assert.Contains(t, logs.String(), "field=Store.SQLDSN")
+	assert.Contains(t, logs.String(), "field=Port")
+	assert.NotContains(t, logs.String(), "hunter2")
+
+	// an invalid file is rejected and the current configuration is kept
+	writeFile(t, file, "log_level: loud\n")
+	_, err = reloader.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "warn", reloader.Current().LogLevel)
+	assert.Len(t, applied, 1)
+}
+
+func TestReloadWatchFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, file, "log_level: info\n")
+
+	reloader := newReloader(t, file, &bytes.Buffer{})
+	var mu sync.Mutex
+	var level string
+	reloader.OnReload(func(cfg *config.Config) {
+		mu.Lock()
+		defer mu.Unlock()
+		level = cfg.LogLevel
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, file, "log_level: error\n")
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(file, later, later))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return level == "error"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRereadEnvFile(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for name, value := range minimal() {
+		t.Setenv(name, value)
+	}
+	t.Setenv("ENV", "")
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("PORT", "9090")
+	t.Setenv("LOG_LEVEL", "")
+	os.Unsetenv("LOG_LEVEL")
+	writeFile(t, ".env.dev", "LOG_LEVEL=warn\nPORT=7070\n")
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, "9090", cfg.Port)
+
+	writeFile(t, ".env.dev", "LOG_LEVEL=error\nPORT=6060\n")
+	cfg, err = config.Reread()
+	assert.NoError(t, err)
+	assert.Equal(t, "error", cfg.LogLevel, "edits to .env.dev are picked up")
+	assert.Equal(t, "9090", cfg.Port, "the real environment still wins")
+	assert.Equal(t, "warn", os.Getenv("LOG_LEVEL"), "the process environment is left alone")
+}
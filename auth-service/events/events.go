@@ -0,0 +1,183 @@
+// Package events publishes user lifecycle events for other services. Each
+// event carries a schema version for its data and is encoded either as a
+// versioned JSON envelope or as a structured-mode CloudEvent.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Type string
+
+const (
+	UserRegistered      Type = "user.registered"
+	UserProfileUpdated  Type = "user.profile_updated"
+	UserDeleted         Type = "user.deleted"
+	UserLoggedIn        Type = "user.logged_in"
+	UserPasswordChanged Type = "user.password_changed"
+)
+
+// Types lists every event type this service publishes.
+func Types() []Type {
+	return []Type{UserRegistered, UserProfileUpdated, UserDeleted, UserLoggedIn, UserPasswordChanged}
+}
+
+const (
+	FormatJSON        = "json"
+	FormatCloudEvents = "cloudevents"
+
+	ContentTypeJSON        = "application/json"
+	ContentTypeCloudEvents = "application/cloudevents+json"
+)
+
+// Event is one change to a user. Subject is the user ID and is used as the
+// partition key, so events for the same user stay in order.
+type Event struct {
+	ID      string
+	Type    Type
+	Version int
+	Subject string
+	Time    time.Time
+	Data    any
+}
+
+// New stamps data with a fresh ID and the current time. Version is the
+// schema version of data and starts at 1.
+func New(eventType Type, subject string, data any) Event {
+	return Event{
+		ID:      uuid.New().String(),
+		Type:    eventType,
+		Version: 1,
+		Subject: subject,
+		Time:    time.Now().UTC(),
+		Data:    data,
+	}
+}
+
+type Registered struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProfileUpdated names the fields that changed; consumers that need the
+// values read them back from the user service.
+type ProfileUpdated struct {
+	ID        string    `json:"id"`
+	Fields    []string  `json:"fields"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Deleted struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type LoggedIn struct {
+	ID       string `json:"id"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+type PasswordChanged struct {
+	ID        string    `json:"id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// envelope is the FormatJSON wire shape.
+type envelope struct {
+	ID      string    `json:"id"`
+	Type    Type      `json:"type"`
+	Version int       `json:"version"`
+	Source  string    `json:"source"`
+	Subject string    `json:"subject"`
+	Time    time.Time `json:"time"`
+	Data    any       `json:"data"`
+}
+
+// cloudEvent is a CloudEvents 1.0 structured-mode JSON event. The data
+// schema version travels in the dataversion extension attribute.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            Type      `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	DataVersion     string    `json:"dataversion"`
+	Data            any       `json:"data"`
+}
+
+// Encode renders event in format and returns the matching content type.
+func Encode(format, source string, event Event) ([]byte, string, error) {
+	switch format {
+	case FormatJSON, "":
+		b, err := json.Marshal(envelope{event.ID, event.Type, event.Version, source, event.Subject, event.Time, event.Data})
+		return b, ContentTypeJSON, err
+	case FormatCloudEvents:
+		b, err := json.Marshal(cloudEvent{
+			SpecVersion:     "1.0",
+			ID:              event.ID,
+			Source:          source,
+			Type:            event.Type,
+			Subject:         event.Subject,
+			Time:            event.Time,
+			DataContentType: ContentTypeJSON,
+			DataVersion:     fmt.Sprint(event.Version),
+			Data:            event.Data,
+		})
+		return b, ContentTypeCloudEvents, err
+	default:
+		return nil, "", fmt.Errorf("events: format must be json or cloudevents, got %q", format)
+	}
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event) error
+	Close() error
+}
+
+type discard struct{}
+
+func (discard) Publish(context.Context, ...Event) error { return nil }
+func (discard) Close() error                            { return nil }
+
+// Discard drops every event.
+var Discard Publisher = discard{}
+
+type multi []Publisher
+
+// Multi publishes every event to each of publishers in turn. It returns
+// the joined errors of the publishers that failed; the others have still
+// received the events.
+func Multi(publishers ...Publisher) Publisher {
+	return multi(publishers)
+}
+
+func (m multi) Publish(ctx context.Context, events ...Event) error {
+	var errs []error
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, events...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multi) Close() error {
+	var errs []error
+	for _, publisher := range m {
+		if err := publisher.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func registered() events.Event {
+	event := events.New(events.UserRegistered, "user-1", events.Registered{ID: "user-1", Email: "a@example.com"})
+	event.Time = time.Date(2024, 5, 25, 10, 0, 0, 0, time.UTC)
+	return event
+}
+
+func TestEncode(t *testing.T) {
+	event := registered()
+
+	t.Run("json", func(t *testing.T) {
+		b, contentType, err := events.Encode(events.FormatJSON, "/auth-service", event)
+		assert.NoError(t, err)
+		assert.Equal(t, events.ContentTypeJSON, contentType)
+
+		var got map[string]any
+		assert.NoError(t, json.Unmarshal(b, &got))
+		assert.Equal(t, event.ID, got["id"])
+		assert.Equal(t, "user.registered", got["type"])
+		assert.Equal(t, float64(1), got["version"])
+		assert.Equal(t, "/auth-service", got["source"])
+		assert.Equal(t, "user-1", got["subject"])
+		assert.Equal(t, "2024-05-25T10:00:00Z", got["time"])
+		assert.Equal(t, "a@example.com", got["data"].(map[string]any)["email"])
+	})
+
+	t.Run("cloudevents", func(t *testing.T) {
+		b, contentType, err := events.Encode(events.FormatCloudEvents, "/auth-service", event)
+		assert.NoError(t, err)
+		assert.Equal(t, events.ContentTypeCloudEvents, contentType)
+
+		var got map[string]any
+		assert.NoError(t, json.Unmarshal(b, &got))
+		assert.Equal(t, "1.0", got["specversion"])
+		assert.Equal(t, "user.registered", got["type"])
+		assert.Equal(t, "1", got["dataversion"])
+		assert.Equal(t, "application/json", got["datacontenttype"])
+		assert.Equal(t, "user-1", got["data"].(map[string]any)["id"])
+	})
+
+	_, _, err := events.Encode("avro", "/auth-service", event)
+	assert.Error(t, err)
+}
+
+func TestMessage(t *testing.T) {
+	event := registered()
+	message, err := events.Message(events.FormatCloudEvents, "/auth-service", event)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("user-1"), message.Key)
+	assert.Equal(t, event.Time, message.Time)
+
+	headers := map[string]string{}
+	for _, h := range message.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	assert.Equal(t, map[string]string{
+		"content-type":  events.ContentTypeCloudEvents,
+		"event-type":    "user.registered",
+		"event-version": "1",
+	}, headers)
+}
+
+func TestNewPublisher(t *testing.T) {
+	publisher, err := events.NewPublisher(events.Config{Publisher: events.PublisherNone})
+	assert.NoError(t, err)
+	assert.Equal(t, events.Discard, publisher)
+
+	_, err = events.NewPublisher(events.Config{Publisher: events.PublisherKafka})
+	assert.ErrorContains(t, err, "broker")
+	_, err = events.NewPublisher(events.Config{Publisher: "nats"})
+	assert.Error(t, err)
+	_, err = events.NewPublisher(events.Config{Format: "avro"})
+	assert.Error(t, err)
+
+	publisher, err = events.NewPublisher(events.Config{Publisher: events.PublisherKafka, Brokers: []string{"localhost:9092"}})
+	assert.NoError(t, err)
+	assert.NoError(t, publisher.Close())
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	memory := events.NewMemory()
+	assert.NoError(t, memory.Publish(ctx, registered()))
+
+	memory.Fail(errors.New("broker down"))
+	assert.Error(t, memory.Publish(ctx, registered()))
+	memory.Fail(nil)
+
+	assert.NoError(t, memory.Publish(ctx, events.New(events.UserLoggedIn, "user-1", events.LoggedIn{ID: "user-1"})))
+	published := memory.Events()
+	assert.Len(t, published, 2)
+	assert.Equal(t, events.UserLoggedIn, published[1].Type)
+}
+
+func TestMulti(t *testing.T) {
+	ctx := context.TODO()
+	first, second := events.NewMemory(), events.NewMemory()
+	publisher := events.Multi(first, second)
+	event := events.New(events.UserDeleted, "u1", events.Deleted{ID: "u1"})
+
+	first.Fail(errors.New("broker down"))
+	assert.EqualError(t, publisher.Publish(ctx, event), "broker down")
+	assert.Empty(t, first.Events())
+	assert.Equal(t, []events.Event{event}, second.Events(), "a failed publisher does not stop the others")
+	assert.NoError(t, publisher.Close())
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	PublisherNone  = "none"
+	PublisherKafka = "kafka"
+
+	// DeliveryDirect publishes from the request path; DeliveryOutbox stores
+	// events with the write and relays them in the background.
+	DeliveryDirect = "direct"
+	DeliveryOutbox = "outbox"
+
+	DefaultTopic  = "auth.user.events"
+	DefaultSource = "/auth-service"
+)
+
+type Config struct {
+	// Publisher is none or kafka.
+	Publisher string   `yaml:"publisher"`
+	Brokers   []string `yaml:"brokers"`
+	Topic     string   `yaml:"topic"`
+	// Format is json or cloudevents.
+	Format string `yaml:"format"`
+	// Source identifies this service in the envelope.
+	Source string `yaml:"source"`
+	// Delivery is direct or outbox.
+	Delivery string `yaml:"delivery"`
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	switch c.Publisher {
+	case PublisherNone, "":
+	case PublisherKafka:
+		if len(c.Brokers) == 0 {
+			errs = append(errs, errors.New("kafka publisher needs at least one broker"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("publisher must be none or kafka, got %q", c.Publisher))
+	}
+	switch c.Delivery {
+	case "", DeliveryDirect, DeliveryOutbox:
+	default:
+		errs = append(errs, fmt.Errorf("delivery must be direct or outbox, got %q", c.Delivery))
+	}
+	switch c.Format {
+	case "", FormatJSON, FormatCloudEvents:
+	default:
+		errs = append(errs, fmt.Errorf("format must be json or cloudevents, got %q", c.Format))
+	}
+	return errors.Join(errs...)
+}
+
+// NewPublisher returns the publisher config selects; none discards events.
+func NewPublisher(config Config) (Publisher, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("events: %w", err)
+	}
+	if config.Publisher != PublisherKafka {
+		return Discard, nil
+	}
+	return NewKafkaPublisher(config), nil
+}
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+	format string
+	source string
+}
+
+// NewKafkaPublisher writes events to config.Topic, keyed by subject and
+// acknowledged by all in-sync replicas. Publish blocks until the broker
+// acknowledges the batch.
+func NewKafkaPublisher(config Config) Publisher {
+	if config.Topic == "" {
+		config.Topic = DefaultTopic
+	}
+	if config.Source == "" {
+		config.Source = DefaultSource
+	}
+	return &kafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(config.Brokers...),
+			Topic:                  config.Topic,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			BatchTimeout:           10 * time.Millisecond,
+			AllowAutoTopicCreation: true,
+		},
+		format: config.Format,
+		source: config.Source,
+	}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, events ...Event) error {
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		message, err := Message(p.format, p.source, event)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+	if err := p.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("events: publish %s: %w", types(events), err)
+	}
+	return nil
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// Message encodes event as a Kafka message keyed by its subject.
+func Message(format, source string, event Event) (kafka.Message, error) {
+	value, contentType, err := Encode(format, source, event)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{
+		Key:   []byte(event.Subject),
+		Value: value,
+		Time:  event.Time,
+		Headers: []kafka.Header{
+			{Key: "content-type", Value: []byte(contentType)},
+			{Key: "event-type", Value: []byte(event.Type)},
+			{Key: "event-version", Value: []byte(fmt.Sprint(event.Version))},
+		},
+	}, nil
+}
+
+func types(events []Event) string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = string(event.Type)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,162 @@
+// Package health serves the liveness and readiness probes. Dependencies are
+// registered as named checkers and checked in parallel, each with its own
+// timeout, on every readiness request.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/router"
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+const DefaultTimeout = 2 * time.Second
+
+// Checker reports whether a dependency is usable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the outcome of one checker.
+type Result struct {
+	Status  Status `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report is the readiness of the service: up only if every check is up.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type check struct {
+	name    string
+	checker Checker
+	timeout time.Duration
+}
+
+type Registry struct {
+	mu     sync.RWMutex
+	checks []check
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a checker that runs with DefaultTimeout. Registering a name
+// again replaces the earlier checker.
+func (r *Registry) Register(name string, checker Checker) {
+	r.RegisterWithTimeout(name, checker, DefaultTimeout)
+}
+
+func (r *Registry) RegisterWithTimeout(name string, checker Checker, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks[i] = check{name, checker, timeout}
+			return
+		}
+	}
+	r.checks = append(r.checks, check{name, checker, timeout})
+	sort.Slice(r.checks, func(i, j int) bool { return r.checks[i].name < r.checks[j].name })
+}
+
+// Check runs every checker in parallel and waits for all of them. A checker
+// that outlives its timeout is reported down.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(checks))}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{Status: StatusUp, Latency: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Livez reports that the process is running and able to serve requests. It
+// checks no dependencies, so an outage elsewhere never gets the service
+// restarted.
+func Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, Report{Status: StatusUp})
+}
+
+// Readyz reports every registered dependency, with 503 if any is down.
+func (r *Registry) Readyz(c *gin.Context) {
+	report := r.Check(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Register serves /livez and /readyz, and /healthz as an alias of /readyz
+// for existing probes.
+func Register(r router.MyRouter, registry *Registry) router.MyRouter {
+	r.GET("/livez", Livez)
+	r.GET("/readyz", registry.Readyz)
+	r.GET("/healthz", registry.Readyz)
+	return r
+}
@@ -0,0 +1,85 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/health"
+	"github.com/sing3demons/auth-service/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func up(context.Context) error { return nil }
+
+func serve(t *testing.T, registry *health.Registry, path string) (int, health.Report) {
+	gin.SetMode(gin.TestMode)
+	r := router.New()
+	health.Register(r, registry)
+
+	recorder := httptest.NewRecorder()
+	r.(http.Handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report health.Report
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	return recorder.Code, report
+}
+
+func TestReadyz(t *testing.T) {
+	registry := health.NewRegistry()
+	registry.Register("database", health.CheckerFunc(up))
+	registry.Register("redis", health.CheckerFunc(up))
+
+	code, report := serve(t, registry, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.NotEmpty(t, report.Checks["redis"].Latency)
+
+	registry.Register("redis", health.CheckerFunc(func(context.Context) error {
+		return errors.New("connection refused")
+	}))
+	code, report = serve(t, registry, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, health.StatusUp, report.Checks["database"].Status)
+	assert.Equal(t, health.Result{Status: health.StatusDown, Latency: report.Checks["redis"].Latency, Error: "connection refused"}, report.Checks["redis"])
+
+	code, _ = serve(t, registry, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestLivez(t *testing.T) {
+	registry := health.NewRegistry()
+	registry.Register("database", health.CheckerFunc(func(context.Context) error {
+		return errors.New("down")
+	}))
+
+	code, report := serve(t, registry, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusUp, report.Status)
+	assert.Empty(t, report.Checks)
+}
+
+func TestCheckTimeout(t *testing.T) {
+	block := health.CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	registry := health.NewRegistry()
+	registry.RegisterWithTimeout("kafka", block, 20*time.Millisecond)
+	registry.RegisterWithTimeout("smtp", block, 20*time.Millisecond)
+
+	start := time.Now()
+	report := registry.Check(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "checks run in parallel and stop at their timeout")
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["kafka"].Error)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["smtp"].Error)
+}
@@ -0,0 +1,113 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	RS256 = "RS256"
+	PS256 = "PS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyType              = errors.New("key type does not match signing algorithm")
+)
+
+// Algorithms sets the signing algorithm per token type.
+type Algorithms struct {
+	Access  string `yaml:"access"`
+	Refresh string `yaml:"refresh"`
+}
+
+func DefaultAlgorithms() Algorithms {
+	return Algorithms{Access: RS256, Refresh: RS256}
+}
+
+func (a Algorithms) For(use Use) string {
+	if use == Refresh {
+		return a.Refresh
+	}
+	return a.Access
+}
+
+func (a Algorithms) Validate() error {
+	for _, alg := range []string{a.Access, a.Refresh} {
+		switch alg {
+		case RS256, PS256, ES256, EdDSA:
+		default:
+			return fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+		}
+	}
+	return nil
+}
+
+func parsePrivateKey(alg string, pem []byte) (crypto.Signer, error) {
+	switch alg {
+	case RS256, PS256:
+		return jwt.ParseRSAPrivateKeyFromPEM(pem)
+	case ES256:
+		key, err := jwt.ParseECPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		if key.Curve != elliptic.P256() {
+			return nil, ErrKeyType
+		}
+		return key, nil
+	case EdDSA:
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		return key.(crypto.Signer), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+}
+
+func parsePublicKey(alg string, pem []byte) (crypto.PublicKey, error) {
+	switch alg {
+	case RS256, PS256:
+		return jwt.ParseRSAPublicKeyFromPEM(pem)
+	case ES256:
+		key, err := jwt.ParseECPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		if key.Curve != elliptic.P256() {
+			return nil, ErrKeyType
+		}
+		return key, nil
+	case EdDSA:
+		return jwt.ParseEdPublicKeyFromPEM(pem)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+}
+
+// checkKeyType rejects a key that cannot produce alg signatures, e.g. an
+// RSA key reported by a KMS for an ES256 signer.
+func checkKeyType(alg string, key crypto.PublicKey) error {
+	ok := false
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		ok = alg == RS256 || alg == PS256
+	case *ecdsa.PublicKey:
+		ok = alg == ES256 && key.Curve == elliptic.P256()
+	case ed25519.PublicKey:
+		ok = alg == EdDSA
+	}
+	if !ok {
+		return ErrKeyType
+	}
+	return nil
+}
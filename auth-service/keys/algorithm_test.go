@@ -0,0 +1,107 @@
+package keys_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateKey(t *testing.T, alg string) crypto.Signer {
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch alg {
+	case keys.RS256, keys.PS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case keys.ES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case keys.EdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	assert.NoError(t, err)
+	return key
+}
+
+func pemSource(t *testing.T, alg string) mapSource {
+	source := mapSource{}
+	for _, names := range [][2]string{
+		{keys.PrivateAccessKey, keys.PublicAccessKey},
+		{keys.PrivateRefreshKey, keys.PublicRefreshKey},
+	} {
+		key := generateKey(t, alg)
+		private, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.NoError(t, err)
+		public, err := x509.MarshalPKIXPublicKey(key.Public())
+		assert.NoError(t, err)
+
+		source[names[0]] = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}))
+		source[names[1]] = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	}
+	return source
+}
+
+func TestAlgorithms(t *testing.T) {
+	for _, alg := range []string{keys.RS256, keys.PS256, keys.ES256, keys.EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			provider, err := keys.LoadWithAlgorithms(pemSource(t, alg), keys.Algorithms{Access: alg, Refresh: alg})
+			assert.NoError(t, err)
+
+			token := signWith(t, provider, keys.Access)
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			assert.NoError(t, err)
+			assert.Equal(t, alg, parsed.Method.Alg())
+
+			assert.NoError(t, verify(t, provider, keys.Access, token))
+			assert.Error(t, verify(t, provider, keys.Refresh, token))
+		})
+	}
+}
+
+func TestAlgorithmPinning(t *testing.T) {
+	source := pemSource(t, keys.RS256)
+	rs256, err := keys.Load(source)
+	assert.NoError(t, err)
+	ps256, err := keys.LoadWithAlgorithms(source, keys.Algorithms{Access: keys.PS256, Refresh: keys.PS256})
+	assert.NoError(t, err)
+
+	// same key, different algorithm
+	token := signWith(t, rs256, keys.Access)
+	assert.NoError(t, verify(t, rs256, keys.Access, token))
+	assert.ErrorIs(t, verify(t, ps256, keys.Access, token), jwt.ErrTokenSignatureInvalid)
+
+	key, err := rs256.VerificationKey(keys.Access, "")
+	assert.NoError(t, err)
+	hs256, err := jwt.New(jwt.SigningMethodHS256).SignedString([]byte(source[keys.PublicAccessKey]))
+	assert.NoError(t, err)
+	_, err = key.Parse(hs256, jwt.MapClaims{})
+	assert.Error(t, err)
+}
+
+func TestAlgorithmKeyType(t *testing.T) {
+	_, err := keys.LoadWithAlgorithms(pemSource(t, keys.RS256), keys.Algorithms{Access: keys.ES256, Refresh: keys.RS256})
+	assert.Error(t, err)
+
+	_, err = keys.LoadWithAlgorithms(pemSource(t, keys.RS256), keys.Algorithms{Access: "HS256", Refresh: keys.RS256})
+	assert.ErrorIs(t, err, keys.ErrUnsupportedAlgorithm)
+
+	_, err = keys.NewLocalSigner("", keys.EdDSA, generateKey(t, keys.ES256))
+	assert.ErrorIs(t, err, keys.ErrKeyType)
+
+	signer, err := keys.NewLocalSigner("v1", keys.ES256, generateKey(t, keys.ES256))
+	assert.NoError(t, err)
+	token, err := keys.SignToken(context.TODO(), signer, jwt.MapClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", keys.HeaderKeyID(token))
+}
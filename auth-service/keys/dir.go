@@ -0,0 +1,142 @@
+package keys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type keySet struct {
+	modTime time.Time
+	active  Signer
+	public  map[string]Key
+}
+
+// DirKeyring serves versioned keys from a directory laid out as
+//
+//	<dir>/access/<version>.pem
+//	<dir>/refresh/<version>.pem
+//
+// Each file holds either a private key or, for a retired version, only its
+// public key, of the type the token's algorithm needs. The private key with
+// the highest version (in lexical order, so use sortable versions such as
+// dates) signs new tokens and becomes their "kid"; every version still
+// present verifies tokens issued with it. The directory is rescanned when its
+// modification time changes.
+type DirKeyring struct {
+	dir        string
+	algorithms Algorithms
+
+	mu   sync.Mutex
+	sets map[Use]*keySet
+}
+
+// NewDirKeyring loads both key sets and fails if either has no signing key.
+func NewDirKeyring(dir string, algorithms Algorithms) (*DirKeyring, error) {
+	if err := algorithms.Validate(); err != nil {
+		return nil, err
+	}
+	k := &DirKeyring{dir: dir, algorithms: algorithms, sets: map[Use]*keySet{}}
+	for _, use := range []Use{Access, Refresh} {
+		if _, err := k.keySet(use); err != nil {
+			return nil, fmt.Errorf("%s keys: %w", use, err)
+		}
+	}
+	return k, nil
+}
+
+func (k *DirKeyring) Signer(use Use) (Signer, error) {
+	set, err := k.keySet(use)
+	if err != nil {
+		return nil, err
+	}
+	return set.active, nil
+}
+
+func (k *DirKeyring) VerificationKey(use Use, kid string) (Key, error) {
+	set, err := k.keySet(use)
+	if err != nil {
+		return Key{}, err
+	}
+	if kid == "" {
+		kid = set.active.KeyID()
+	}
+	key, ok := set.public[kid]
+	if !ok {
+		return Key{}, ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+// keySet returns the cached keys for use, rescanning the directory if it
+// changed. A rescan that fails keeps the previous keys, so a half-finished
+// rotation does not take the service down; it is retried on the next call.
+func (k *DirKeyring) keySet(use Use) (*keySet, error) {
+	dir := filepath.Join(k.dir, string(use))
+	info, err := os.Stat(dir)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	current := k.sets[use]
+	if err != nil {
+		if current != nil {
+			return current, nil
+		}
+		return nil, err
+	}
+	if current != nil && current.modTime.Equal(info.ModTime()) {
+		return current, nil
+	}
+
+	set, err := readKeySet(dir, k.algorithms.For(use))
+	if err != nil {
+		if current != nil {
+			return current, nil
+		}
+		return nil, err
+	}
+	set.modTime = info.ModTime()
+	k.sets[use] = set
+	return set, nil
+}
+
+func readKeySet(dir, alg string) (*keySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &keySet{public: map[string]Key{}}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".pem" {
+			continue
+		}
+		version := strings.TrimSuffix(name, ".pem")
+
+		pem, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		if private, err := parsePrivateKey(alg, pem); err == nil {
+			set.active = &localSigner{version, alg, private}
+			set.public[version] = Key{ID: version, Algorithm: alg, Public: private.Public()}
+			continue
+		}
+		public, err := parsePublicKey(alg, pem)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		set.public[version] = Key{ID: version, Algorithm: alg, Public: public}
+	}
+
+	if set.active == nil {
+		return nil, ErrPrivateKeyNotFound
+	}
+	return set, nil
+}
@@ -0,0 +1,56 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fileEntry struct {
+	modTime time.Time
+	size    int64
+	content string
+}
+
+// FileSource reads PEM keys from files in Dir, one per key name, e.g.
+// Dir/private_access_key.pem. This matches a Kubernetes secret mounted as a
+// volume. A file is re-read only after its modification time or size
+// changes, so rotated secrets are picked up without a restart.
+type FileSource struct {
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]fileEntry
+}
+
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{Dir: dir, files: map[string]fileEntry{}}
+}
+
+func (s *FileSource) Path(name string) string {
+	return filepath.Join(s.Dir, strings.ToLower(name)+".pem")
+}
+
+func (s *FileSource) Lookup(name string) (string, bool) {
+	path := s.Path(name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.files[path]; ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.content, true
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	s.files[path] = fileEntry{info.ModTime(), info.Size(), string(content)}
+	return string(content), true
+}
@@ -0,0 +1,180 @@
+package keys
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	PrivateAccessKey  = "PRIVATE_ACCESS_KEY"
+	PublicAccessKey   = "PUBLIC_ACCESS_KEY"
+	PrivateRefreshKey = "PRIVATE_REFRESH_KEY"
+	PublicRefreshKey  = "PUBLIC_REFRESH_KEY"
+)
+
+var (
+	ErrPublicKeyNotFound  = errors.New("public key not found")
+	ErrPrivateKeyNotFound = errors.New("private key not found")
+	ErrKeyMismatch        = errors.New("public key does not match private key")
+)
+
+// Source returns the raw key material for a key name, either PEM text or
+// base64-encoded PEM. The returned string doubles as the key's fingerprint:
+// the provider re-parses a key only when it changes.
+type Source interface {
+	Lookup(name string) (string, bool)
+}
+
+// EnvSource reads base64-encoded PEM keys from environment variables.
+type EnvSource struct{}
+
+func (EnvSource) Lookup(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
+
+type cachedKey struct {
+	raw string
+	key interface{}
+}
+
+// Provider hands out parsed signing and verification keys. Each key is
+// decoded once and kept until its source material changes, so the hot path
+// is a map lookup and a string comparison.
+type Provider struct {
+	source     Source
+	algorithms Algorithms
+
+	mu    sync.RWMutex
+	cache map[string]cachedKey
+}
+
+// NewProvider returns an RS256 provider that loads keys lazily on first use.
+func NewProvider(source Source) *Provider {
+	return &Provider{source: source, algorithms: DefaultAlgorithms(), cache: map[string]cachedKey{}}
+}
+
+func NewProviderWithAlgorithms(source Source, algorithms Algorithms) (*Provider, error) {
+	if err := algorithms.Validate(); err != nil {
+		return nil, err
+	}
+	p := NewProvider(source)
+	p.algorithms = algorithms
+	return p, nil
+}
+
+// Load returns a provider whose keys have all been parsed and checked
+// against each other, so misconfiguration fails at startup rather than on
+// the first request.
+func Load(source Source) (*Provider, error) {
+	return LoadWithAlgorithms(source, DefaultAlgorithms())
+}
+
+func LoadWithAlgorithms(source Source, algorithms Algorithms) (*Provider, error) {
+	p, err := NewProviderWithAlgorithms(source, algorithms)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Provider) Validate() error {
+	for _, use := range []Use{Access, Refresh} {
+		privateName, publicName := keyNames(use)
+		private, err := p.privateKey(use)
+		if err != nil {
+			return fmt.Errorf("%s: %w", privateName, err)
+		}
+		public, err := p.publicKey(use)
+		if err != nil {
+			return fmt.Errorf("%s: %w", publicName, err)
+		}
+		if !public.(interface{ Equal(crypto.PublicKey) bool }).Equal(private.Public()) {
+			return fmt.Errorf("%s: %w", publicName, ErrKeyMismatch)
+		}
+	}
+	return nil
+}
+
+func (p *Provider) AccessPrivateKey() (crypto.Signer, error) {
+	return p.privateKey(Access)
+}
+
+func (p *Provider) AccessPublicKey() (crypto.PublicKey, error) {
+	return p.publicKey(Access)
+}
+
+func (p *Provider) RefreshPrivateKey() (crypto.Signer, error) {
+	return p.privateKey(Refresh)
+}
+
+func (p *Provider) RefreshPublicKey() (crypto.PublicKey, error) {
+	return p.publicKey(Refresh)
+}
+
+func keyNames(use Use) (private, public string) {
+	if use == Refresh {
+		return PrivateRefreshKey, PublicRefreshKey
+	}
+	return PrivateAccessKey, PublicAccessKey
+}
+
+func (p *Provider) privateKey(use Use) (crypto.Signer, error) {
+	name, _ := keyNames(use)
+	alg := p.algorithms.For(use)
+	key, err := p.load(name, ErrPrivateKeyNotFound, func(pem []byte) (interface{}, error) {
+		return parsePrivateKey(alg, pem)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key.(crypto.Signer), nil
+}
+
+func (p *Provider) publicKey(use Use) (crypto.PublicKey, error) {
+	_, name := keyNames(use)
+	alg := p.algorithms.For(use)
+	return p.load(name, ErrPublicKeyNotFound, func(pem []byte) (interface{}, error) {
+		return parsePublicKey(alg, pem)
+	})
+}
+
+func (p *Provider) load(name string, notFound error, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	raw, ok := p.source.Lookup(name)
+	if !ok || raw == "" {
+		return nil, notFound
+	}
+
+	p.mu.RLock()
+	cached, ok := p.cache[name]
+	p.mu.RUnlock()
+	if ok && cached.raw == raw {
+		return cached.key, nil
+	}
+
+	pem := []byte(raw)
+	if !strings.HasPrefix(raw, "-----BEGIN") {
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, err
+		}
+		pem = decoded
+	}
+	key, err := parse(pem)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cache[name] = cachedKey{raw: raw, key: key}
+	p.mu.Unlock()
+
+	return key, nil
+}
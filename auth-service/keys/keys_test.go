@@ -0,0 +1,91 @@
+package keys_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapSource map[string]string
+
+func (m mapSource) Lookup(name string) (string, bool) {
+	v, ok := m[name]
+	return v, ok
+}
+
+func encodeKeyPair(t *testing.T) (private, public string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+
+	private = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	public = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return private, public
+}
+
+func newSource(t *testing.T) mapSource {
+	accessPrivate, accessPublic := encodeKeyPair(t)
+	refreshPrivate, refreshPublic := encodeKeyPair(t)
+	return mapSource{
+		keys.PrivateAccessKey:  accessPrivate,
+		keys.PublicAccessKey:   accessPublic,
+		keys.PrivateRefreshKey: refreshPrivate,
+		keys.PublicRefreshKey:  refreshPublic,
+	}
+}
+
+func TestLoad(t *testing.T) {
+	source := newSource(t)
+
+	provider, err := keys.Load(source)
+	assert.NoError(t, err)
+
+	first, err := provider.AccessPublicKey()
+	assert.NoError(t, err)
+	second, err := provider.AccessPublicKey()
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+}
+
+func TestLoadMissingKey(t *testing.T) {
+	source := newSource(t)
+	delete(source, keys.PublicRefreshKey)
+
+	_, err := keys.Load(source)
+	assert.ErrorIs(t, err, keys.ErrPublicKeyNotFound)
+}
+
+func TestLoadMismatch(t *testing.T) {
+	source := newSource(t)
+	source[keys.PublicAccessKey] = source[keys.PublicRefreshKey]
+
+	_, err := keys.Load(source)
+	assert.ErrorIs(t, err, keys.ErrKeyMismatch)
+}
+
+func TestProviderReload(t *testing.T) {
+	source := newSource(t)
+	provider := keys.NewProvider(source)
+
+	before, err := provider.AccessPrivateKey()
+	assert.NoError(t, err)
+
+	private, _ := encodeKeyPair(t)
+	source[keys.PrivateAccessKey] = private
+
+	after, err := provider.AccessPrivateKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, before.Public(), after.Public())
+
+	source[keys.PrivateAccessKey] = "invalid"
+	_, err = provider.AccessPrivateKey()
+	assert.Error(t, err)
+}
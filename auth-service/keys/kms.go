@@ -0,0 +1,66 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+)
+
+// KMS is the subset of a key management service needed to sign tokens. The
+// private key stays in the service; only digests and signatures cross the
+// boundary. Sign returns the signature in JWS encoding for alg.
+type KMS interface {
+	PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error)
+	Sign(ctx context.Context, keyID, alg string, message []byte) ([]byte, error)
+}
+
+type kmsSigner struct {
+	kms    KMS
+	keyID  string
+	alg    string
+	public crypto.PublicKey
+}
+
+// NewKMSSigner fetches the public half of keyID once and signs through kms.
+func NewKMSSigner(ctx context.Context, kms KMS, keyID, alg string) (Signer, error) {
+	public, err := kms.PublicKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeyType(alg, public); err != nil {
+		return nil, err
+	}
+	return &kmsSigner{kms, keyID, alg, public}, nil
+}
+
+func (s *kmsSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *kmsSigner) Algorithm() string {
+	return s.alg
+}
+
+func (s *kmsSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *kmsSigner) Sign(ctx context.Context, message []byte) ([]byte, error) {
+	return s.kms.Sign(ctx, s.keyID, s.alg, message)
+}
+
+// NewKMSKeyring signs access and refresh tokens with the KMS keys accessKeyID
+// and refreshKeyID, using the algorithms configured for each use.
+func NewKMSKeyring(ctx context.Context, kms KMS, accessKeyID, refreshKeyID string, algorithms Algorithms) (Keyring, error) {
+	if err := algorithms.Validate(); err != nil {
+		return nil, err
+	}
+	access, err := NewKMSSigner(ctx, kms, accessKeyID, algorithms.For(Access))
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := NewKMSSigner(ctx, kms, refreshKeyID, algorithms.For(Refresh))
+	if err != nil {
+		return nil, err
+	}
+	return NewSignerKeyring(access, refresh), nil
+}
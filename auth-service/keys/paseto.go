@@ -0,0 +1,97 @@
+package keys
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const pasetoV4Public = "v4.public."
+
+var ErrPasetoInvalid = errors.New("paseto: invalid token")
+
+// IsPaseto reports whether token is a PASETO v4.public token rather than a
+// JWT.
+func IsPaseto(token string) bool {
+	return strings.HasPrefix(token, pasetoV4Public)
+}
+
+// SignPaseto issues a PASETO v4.public token over payload. v4.public is
+// Ed25519 only, so signer must use EdDSA. The signer's key id, if any, is
+// carried in the footer as {"kid":"..."}.
+func SignPaseto(ctx context.Context, signer Signer, payload []byte) (string, error) {
+	if signer.Algorithm() != EdDSA {
+		return "", fmt.Errorf("%w: paseto v4.public requires %s, got %s", ErrUnsupportedAlgorithm, EdDSA, signer.Algorithm())
+	}
+
+	var footer []byte
+	if kid := signer.KeyID(); kid != "" {
+		footer, _ = json.Marshal(struct {
+			KeyID string `json:"kid"`
+		}{kid})
+	}
+
+	sig, err := signer.Sign(ctx, pae([]byte(pasetoV4Public), payload, footer, nil))
+	if err != nil {
+		return "", err
+	}
+
+	token := pasetoV4Public + base64.RawURLEncoding.EncodeToString(append(payload[:len(payload):len(payload)], sig...))
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token, nil
+}
+
+// ParsePaseto verifies a PASETO v4.public token against k and returns its
+// payload. k must be an Ed25519 key pinned to EdDSA.
+func (k Key) ParsePaseto(token string) ([]byte, error) {
+	public, ok := k.Public.(ed25519.PublicKey)
+	if k.Algorithm != EdDSA || !ok {
+		return nil, fmt.Errorf("%w: paseto v4.public requires %s", ErrUnsupportedAlgorithm, EdDSA)
+	}
+
+	payload, footer, err := splitPaseto(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < ed25519.SignatureSize {
+		return nil, ErrPasetoInvalid
+	}
+
+	message, sig := payload[:len(payload)-ed25519.SignatureSize], payload[len(payload)-ed25519.SignatureSize:]
+	if !ed25519.Verify(public, pae([]byte(pasetoV4Public), message, footer, nil), sig) {
+		return nil, ErrPasetoInvalid
+	}
+	return message, nil
+}
+
+func splitPaseto(token string) (payload, footer []byte, err error) {
+	if !IsPaseto(token) {
+		return nil, nil, ErrPasetoInvalid
+	}
+	body, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, pasetoV4Public), ".")
+	if payload, err = base64.RawURLEncoding.DecodeString(body); err != nil {
+		return nil, nil, ErrPasetoInvalid
+	}
+	if footer, err = base64.RawURLEncoding.DecodeString(encodedFooter); err != nil {
+		return nil, nil, ErrPasetoInvalid
+	}
+	return payload, footer, nil
+}
+
+// pae is PASETO's pre-authentication encoding: the piece count followed by
+// each piece prefixed with its length, all as little-endian uint64s.
+func pae(pieces ...[]byte) []byte {
+	out := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces)))
+	for _, piece := range pieces {
+		out = binary.LittleEndian.AppendUint64(out, uint64(len(piece))&^(1<<63))
+		out = append(out, piece...)
+	}
+	return out
+}
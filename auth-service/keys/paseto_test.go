@@ -0,0 +1,55 @@
+package keys_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaseto(t *testing.T) {
+	ctx := context.TODO()
+	signer, err := keys.NewLocalSigner("v1", keys.EdDSA, generateKey(t, keys.EdDSA))
+	assert.NoError(t, err)
+	key := keys.Key{ID: "v1", Algorithm: keys.EdDSA, Public: signer.Public()}
+
+	token, err := keys.SignPaseto(ctx, signer, []byte(`{"sub":"1"}`))
+	assert.NoError(t, err)
+	assert.True(t, keys.IsPaseto(token))
+	assert.Equal(t, "v1", keys.HeaderKeyID(token))
+
+	payload, err := key.ParsePaseto(token)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"sub":"1"}`, string(payload))
+
+	t.Run("tampered footer", func(t *testing.T) {
+		body, _, _ := strings.Cut(token[len("v4.public."):], ".")
+		_, err := key.ParsePaseto("v4.public." + body + ".eyJraWQiOiJ2MiJ9")
+		assert.ErrorIs(t, err, keys.ErrPasetoInvalid)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other := keys.Key{Algorithm: keys.EdDSA, Public: generateKey(t, keys.EdDSA).Public()}
+		_, err := other.ParsePaseto(token)
+		assert.ErrorIs(t, err, keys.ErrPasetoInvalid)
+	})
+
+	t.Run("requires EdDSA", func(t *testing.T) {
+		es256, err := keys.NewLocalSigner("", keys.ES256, generateKey(t, keys.ES256))
+		assert.NoError(t, err)
+		_, err = keys.SignPaseto(ctx, es256, []byte(`{}`))
+		assert.ErrorIs(t, err, keys.ErrUnsupportedAlgorithm)
+
+		_, err = keys.Key{Algorithm: keys.ES256, Public: es256.Public()}.ParsePaseto(token)
+		assert.ErrorIs(t, err, keys.ErrUnsupportedAlgorithm)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, token := range []string{"v4.public.", "v4.public.!!", "v4.local.AAAA", "v4.public.AAAA"} {
+			_, err := key.ParsePaseto(token)
+			assert.ErrorIs(t, err, keys.ErrPasetoInvalid, token)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Use tells which token a key signs.
+type Use string
+
+const (
+	Access  Use = "access"
+	Refresh Use = "refresh"
+)
+
+var ErrUnknownKeyID = errors.New("unknown key id")
+
+// Signer signs tokens with a single key and algorithm. Sign receives the JWS
+// signing input and returns the raw signature, so an implementation can
+// forward it to a KMS or HSM and never hold the private key itself.
+type Signer interface {
+	KeyID() string
+	Algorithm() string
+	Public() crypto.PublicKey
+	Sign(ctx context.Context, message []byte) ([]byte, error)
+}
+
+// Key verifies tokens issued under one key id. The algorithm is pinned: a
+// token whose header names any other algorithm is rejected.
+type Key struct {
+	ID        string
+	Algorithm string
+	Public    crypto.PublicKey
+}
+
+func (k Key) Parse(token string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return k.Public, nil
+	}, jwt.WithValidMethods([]string{k.Algorithm}))
+}
+
+// Keyring resolves the signer for new tokens and the key that verifies an
+// existing token, by the "kid" header it was issued with.
+type Keyring interface {
+	Signer(use Use) (Signer, error)
+	VerificationKey(use Use, kid string) (Key, error)
+}
+
+type localSigner struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+// NewLocalSigner signs with an in-process private key. The key type must
+// match alg.
+func NewLocalSigner(kid, alg string, key crypto.Signer) (Signer, error) {
+	if err := checkKeyType(alg, key.Public()); err != nil {
+		return nil, err
+	}
+	return &localSigner{kid, alg, key}, nil
+}
+
+func (s *localSigner) KeyID() string {
+	return s.kid
+}
+
+func (s *localSigner) Algorithm() string {
+	return s.alg
+}
+
+func (s *localSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *localSigner) Sign(_ context.Context, message []byte) ([]byte, error) {
+	return jwt.GetSigningMethod(s.alg).Sign(string(message), s.key)
+}
+
+// SignToken issues a JWT through signer, setting the "kid" header when the
+// signer has one.
+func SignToken(ctx context.Context, signer Signer, claims jwt.Claims) (string, error) {
+	method := jwt.GetSigningMethod(signer.Algorithm())
+	if method == nil {
+		return "", ErrUnsupportedAlgorithm
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid := signer.KeyID(); kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signingString, err := token.SigningString()
+	if err != nil {
+		return "", err
+	}
+	sig, err := signer.Sign(ctx, []byte(signingString))
+	if err != nil {
+		return "", err
+	}
+	return signingString + "." + token.EncodeSegment(sig), nil
+}
+
+// HeaderKeyID returns the "kid" of a compact JWT header or a PASETO footer
+// without verifying the token, or "" if it has none or is malformed.
+func HeaderKeyID(token string) string {
+	var raw []byte
+	if IsPaseto(token) {
+		_, footer, err := splitPaseto(token)
+		if err != nil {
+			return ""
+		}
+		raw = footer
+	} else {
+		header, _, ok := strings.Cut(token, ".")
+		if !ok {
+			return ""
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(header)
+		if err != nil {
+			return ""
+		}
+		raw = decoded
+	}
+	var h struct {
+		KeyID string `json:"kid"`
+	}
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return ""
+	}
+	return h.KeyID
+}
+
+func (p *Provider) Signer(use Use) (Signer, error) {
+	key, err := p.privateKey(use)
+	if err != nil {
+		return nil, err
+	}
+	return &localSigner{alg: p.algorithms.For(use), key: key}, nil
+}
+
+// VerificationKey ignores kid: environment and file sources hold a single key
+// per token type.
+func (p *Provider) VerificationKey(use Use, kid string) (Key, error) {
+	public, err := p.publicKey(use)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Algorithm: p.algorithms.For(use), Public: public}, nil
+}
+
+type signerKeyring struct {
+	signers map[Use]Signer
+}
+
+// NewSignerKeyring serves fixed signers, typically external ones whose
+// private keys live outside the process. Tokens are verified with the
+// signer's public key.
+func NewSignerKeyring(access, refresh Signer) Keyring {
+	return &signerKeyring{map[Use]Signer{Access: access, Refresh: refresh}}
+}
+
+func (k *signerKeyring) Signer(use Use) (Signer, error) {
+	signer, ok := k.signers[use]
+	if !ok || signer == nil {
+		return nil, ErrPrivateKeyNotFound
+	}
+	return signer, nil
+}
+
+func (k *signerKeyring) VerificationKey(use Use, kid string) (Key, error) {
+	signer, err := k.Signer(use)
+	if err != nil {
+		return Key{}, ErrPublicKeyNotFound
+	}
+	if kid != "" && kid != signer.KeyID() {
+		return Key{}, ErrUnknownKeyID
+	}
+	return Key{ID: signer.KeyID(), Algorithm: signer.Algorithm(), Public: signer.Public()}, nil
+}
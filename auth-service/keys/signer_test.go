@@ -0,0 +1,132 @@
+package keys_test
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodePEM(t *testing.T, encoded string) []byte {
+	pem, err := base64.StdEncoding.DecodeString(encoded)
+	assert.NoError(t, err)
+	return pem
+}
+
+func verify(t *testing.T, keyring keys.Keyring, use keys.Use, token string) error {
+	key, err := keyring.VerificationKey(use, keys.HeaderKeyID(token))
+	if err != nil {
+		return err
+	}
+	_, err = key.Parse(token, jwt.MapClaims{})
+	return err
+}
+
+func signWith(t *testing.T, keyring keys.Keyring, use keys.Use) string {
+	signer, err := keyring.Signer(use)
+	assert.NoError(t, err)
+	token, err := keys.SignToken(context.TODO(), signer, jwt.MapClaims{"sub": "1"})
+	assert.NoError(t, err)
+	return token
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	source := keys.NewFileSource(dir)
+	for name, encoded := range newSource(t) {
+		assert.NoError(t, os.WriteFile(source.Path(name), decodePEM(t, encoded), 0o600))
+	}
+
+	provider, err := keys.Load(source)
+	assert.NoError(t, err)
+	assert.NoError(t, verify(t, provider, keys.Access, signWith(t, provider, keys.Access)))
+	assert.Equal(t, "", keys.HeaderKeyID(signWith(t, provider, keys.Access)))
+
+	// a rotated secret is picked up without reloading the provider
+	rotated := newSource(t)
+	old := signWith(t, provider, keys.Refresh)
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{keys.PrivateRefreshKey, keys.PublicRefreshKey} {
+		assert.NoError(t, os.WriteFile(source.Path(name), decodePEM(t, rotated[name]), 0o600))
+		assert.NoError(t, os.Chtimes(source.Path(name), later, later))
+	}
+	assert.Error(t, verify(t, provider, keys.Refresh, old))
+	assert.NoError(t, verify(t, provider, keys.Refresh, signWith(t, provider, keys.Refresh)))
+}
+
+func TestDirKeyring(t *testing.T) {
+	dir := t.TempDir()
+	source := newSource(t)
+	writeKey := func(use keys.Use, version, name string) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, string(use)), 0o700))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, string(use), version+".pem"), decodePEM(t, source[name]), 0o600))
+	}
+
+	_, err := keys.NewDirKeyring(dir, keys.DefaultAlgorithms())
+	assert.Error(t, err)
+
+	writeKey(keys.Access, "2024-01", keys.PrivateAccessKey)
+	writeKey(keys.Refresh, "2024-01", keys.PrivateRefreshKey)
+
+	keyring, err := keys.NewDirKeyring(dir, keys.DefaultAlgorithms())
+	assert.NoError(t, err)
+
+	old := signWith(t, keyring, keys.Access)
+	assert.Equal(t, "2024-01", keys.HeaderKeyID(old))
+
+	// rotate: the old version is kept as a public key only
+	writeKey(keys.Access, "2024-01", keys.PublicAccessKey)
+	source = newSource(t)
+	writeKey(keys.Access, "2024-02", keys.PrivateAccessKey)
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "access"), later, later))
+
+	token := signWith(t, keyring, keys.Access)
+	assert.Equal(t, "2024-02", keys.HeaderKeyID(token))
+	assert.NoError(t, verify(t, keyring, keys.Access, token))
+	assert.NoError(t, verify(t, keyring, keys.Access, old))
+
+	// retiring the version rejects its tokens
+	assert.NoError(t, os.Remove(filepath.Join(dir, "access", "2024-01.pem")))
+	later = later.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "access"), later, later))
+	assert.ErrorIs(t, verify(t, keyring, keys.Access, old), keys.ErrUnknownKeyID)
+}
+
+func TestKMSSigner(t *testing.T) {
+	ctx := context.TODO()
+	kms := keys.NewFakeKMS()
+	assert.NoError(t, kms.CreateKey("access-1", keys.ES256))
+	assert.NoError(t, kms.CreateKey("refresh-1", keys.EdDSA))
+
+	_, err := keys.NewKMSSigner(ctx, kms, "missing", keys.RS256)
+	assert.ErrorIs(t, err, keys.ErrKMSKeyNotFound)
+
+	access, err := keys.NewKMSSigner(ctx, kms, "access-1", keys.ES256)
+	assert.NoError(t, err)
+	refresh, err := keys.NewKMSSigner(ctx, kms, "refresh-1", keys.EdDSA)
+	assert.NoError(t, err)
+	keyring := keys.NewSignerKeyring(access, refresh)
+
+	_, err = keys.NewKMSSigner(ctx, kms, "access-1", keys.RS256)
+	assert.ErrorIs(t, err, keys.ErrKeyType)
+
+	token := signWith(t, keyring, keys.Access)
+	assert.Equal(t, "access-1", keys.HeaderKeyID(token))
+	assert.NoError(t, verify(t, keyring, keys.Access, token))
+	assert.Error(t, verify(t, keyring, keys.Refresh, token))
+
+	algorithms := keys.Algorithms{Access: keys.ES256, Refresh: keys.EdDSA}
+	_, err = keys.NewKMSKeyring(ctx, kms, "refresh-1", "access-1", algorithms)
+	assert.ErrorIs(t, err, keys.ErrKeyType)
+	keyring, err = keys.NewKMSKeyring(ctx, kms, "access-1", "refresh-1", algorithms)
+	assert.NoError(t, err)
+	assert.Equal(t, "refresh-1", keys.HeaderKeyID(signWith(t, keyring, keys.Refresh)))
+	assert.NoError(t, verify(t, keyring, keys.Refresh, signWith(t, keyring, keys.Refresh)))
+}
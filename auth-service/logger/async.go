@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+type DropPolicy string
+
+const (
+	// DropNewest discards the record being logged when the buffer is full.
+	DropNewest DropPolicy = "newest"
+	// DropOldest discards the oldest buffered record to make room.
+	DropOldest DropPolicy = "oldest"
+	// Block waits for room, so nothing is lost but logging can stall.
+	Block DropPolicy = "block"
+)
+
+type AsyncConfig struct {
+	Enabled    bool       `yaml:"enabled"`
+	BufferSize int        `yaml:"buffer_size"`
+	Drop       DropPolicy `yaml:"drop"`
+}
+
+const defaultAsyncBuffer = 1024
+
+type asyncRecord struct {
+	handler slog.Handler
+	ctx     context.Context
+	record  slog.Record
+}
+
+type asyncQueue struct {
+	records chan asyncRecord
+	drop    DropPolicy
+	dropped atomic.Uint64
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+}
+
+// AsyncHandler hands records to a background goroutine that runs the wrapped
+// handler, so slow sinks do not hold up the caller. Close flushes what is
+// buffered.
+type AsyncHandler struct {
+	next  slog.Handler
+	queue *asyncQueue
+}
+
+func NewAsyncHandler(next slog.Handler, config AsyncConfig) (*AsyncHandler, error) {
+	switch config.Drop {
+	case "":
+		config.Drop = DropNewest
+	case DropNewest, DropOldest, Block:
+	default:
+		return nil, fmt.Errorf("logger: async drop policy must be newest, oldest or block, got %q", config.Drop)
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultAsyncBuffer
+	}
+	queue := &asyncQueue{
+		records: make(chan asyncRecord, config.BufferSize),
+		drop:    config.Drop,
+		done:    make(chan struct{}),
+	}
+	go queue.run()
+	return &AsyncHandler{next: next, queue: queue}, nil
+}
+
+func (q *asyncQueue) run() {
+	defer close(q.done)
+	for r := range q.records {
+		r.handler.Handle(r.ctx, r.record)
+	}
+}
+
+func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
+	q := h.queue
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return nil
+	}
+
+	// the caller is free to cancel ctx once Handle returns
+	item := asyncRecord{handler: h.next, ctx: context.WithoutCancel(ctx), record: r.Clone()}
+	switch q.drop {
+	case Block:
+		q.records <- item
+		return nil
+	case DropOldest:
+		for {
+			select {
+			case q.records <- item:
+				return nil
+			default:
+			}
+			select {
+			case <-q.records:
+				q.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case q.records <- item:
+		default:
+			q.dropped.Add(1)
+		}
+		return nil
+	}
+}
+
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &AsyncHandler{next: h.next.WithAttrs(attrs), queue: h.queue}
+}
+
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	return &AsyncHandler{next: h.next.WithGroup(name), queue: h.queue}
+}
+
+// Dropped counts the records discarded because the buffer was full.
+func (h *AsyncHandler) Dropped() uint64 {
+	return h.queue.dropped.Load()
+}
+
+func (h *AsyncHandler) Close() error {
+	q := h.queue
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.records)
+	}
+	q.mu.Unlock()
+	<-q.done
+	return nil
+}
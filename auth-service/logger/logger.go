@@ -1,40 +1,66 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
-	"os"
 )
 
-func New() *slog.Logger {
-
-	logger := slog.New(slog.NewJSONHandler(os.Stdout,
-		&slog.HandlerOptions{
-			Level: setLogLevel(),
-			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
-				if a.Key == "time" {
-					return slog.Attr{Key: "@timestamp", Value: a.Value}
-				}
-				return a
-			},
-		})).With("serviceName", "auth-service")
-
-	slog.SetDefault(logger)
+type Config struct {
+	// Level is the minimum level logged by sinks without a level of their
+	// own. Pass a *slog.LevelVar to change it while the service runs.
+	Level slog.Leveler
+	// ServiceName is added to every line as serviceName.
+	ServiceName string
+	// Sinks are written to together; none means JSON to stdout.
+	Sinks []SinkConfig
+	// Redact is applied to every line before it is written.
+	Redact []Rule
+}
 
+// New logs JSON to stdout at level with the default redaction rules.
+func New(level slog.Leveler) *slog.Logger {
+	logger, _, err := NewWithConfig(Config{Level: level, Redact: DefaultRedactRules()})
+	if err != nil {
+		panic(err)
+	}
 	return logger
 }
 
-func setLogLevel() slog.Leveler {
-	logLevel := os.Getenv("LOG_LEVEL")
-	switch logLevel {
-	case "debug":
-		return slog.LevelDebug
-	case "info":
-		return slog.LevelInfo
-	case "warn":
-		return slog.LevelWarn
-	case "error":
-		return slog.LevelError
-	default:
-		return slog.LevelDebug
+// NewWithConfig also returns a Closer that flushes async sinks and closes
+// files and syslog connections; call it on shutdown.
+func NewWithConfig(config Config) (*slog.Logger, io.Closer, error) {
+	if config.ServiceName == "" {
+		config.ServiceName = "auth-service"
+	}
+	if len(config.Sinks) == 0 {
+		config.Sinks = DefaultSinks()
+	}
+
+	var sinks fanoutHandler
+	var opened closers
+	for i, sink := range config.Sinks {
+		handler, c, err := newSink(sink, config.Level)
+		if err != nil {
+			opened.Close()
+			return nil, nil, fmt.Errorf("logger: sink %d: %w", i, err)
+		}
+		sinks, opened = append(sinks, handler), append(opened, c...)
 	}
+
+	var handler slog.Handler = sinks
+	if len(sinks) == 1 {
+		handler = sinks[0]
+	}
+	handler, err := NewRedactingHandler(handler, config.Redact)
+	if err != nil {
+		opened.Close()
+		return nil, nil, err
+	}
+
+	logger := slog.New(handler).With("serviceName", config.ServiceName)
+
+	slog.SetDefault(logger)
+
+	return logger, opened, nil
 }
@@ -0,0 +1,188 @@
+package logger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+)
+
+type Action string
+
+const (
+	// ActionMask replaces the value with [REDACTED].
+	ActionMask Action = "mask"
+	// ActionHash replaces the value with a short SHA-256 digest, so equal
+	// values can still be correlated across lines.
+	ActionHash Action = "hash"
+	// ActionDrop removes the attribute, or the matched text from a message.
+	ActionDrop Action = "drop"
+)
+
+const masked = "[REDACTED]"
+
+// Rule redacts attributes whose key matches Key, or text inside string
+// values and messages that matches Value. Both are case-insensitive regular
+// expressions; a rule sets one of them.
+type Rule struct {
+	Key    string `yaml:"key"`
+	Value  string `yaml:"value"`
+	Action Action `yaml:"action"`
+}
+
+func DefaultRedactRules() []Rule {
+	return []Rule{
+		{Key: `pass(word)?|secret|private`, Action: ActionDrop},
+		{Key: `token|authorization|cookie|api[-_]?key`, Action: ActionMask},
+		{Key: `e-?mail`, Action: ActionHash},
+		// JWTs and PASETO v4.public tokens
+		{Value: `eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`, Action: ActionMask},
+		{Value: `v4\.public\.[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)?`, Action: ActionMask},
+		{Value: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, Action: ActionHash},
+	}
+}
+
+// ValidateRules reports the first rule with an unknown action or an invalid
+// pattern.
+func ValidateRules(rules []Rule) error {
+	_, err := compile(rules)
+	return err
+}
+
+type rule struct {
+	key    *regexp.Regexp
+	value  *regexp.Regexp
+	action Action
+}
+
+func compile(rules []Rule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		switch r.Action {
+		case ActionMask, ActionHash, ActionDrop:
+		default:
+			return nil, fmt.Errorf("logger: unknown redact action %q", r.Action)
+		}
+		if (r.Key == "") == (r.Value == "") {
+			return nil, fmt.Errorf("logger: redact rule needs exactly one of key or value")
+		}
+		c := rule{action: r.Action}
+		pattern := r.Key + r.Value
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("logger: redact pattern %q: %w", pattern, err)
+		}
+		if r.Key != "" {
+			c.key = re
+		} else {
+			c.value = re
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+type redactingHandler struct {
+	next  slog.Handler
+	rules []rule
+}
+
+// NewRedactingHandler applies rules to every record before passing it to
+// next, including attributes added with With and inside groups.
+func NewRedactingHandler(next slog.Handler, rules []Rule) (slog.Handler, error) {
+	compiled, err := compile(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &redactingHandler{next, compiled}, nil
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactString(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		if a, ok := h.redact(a); ok {
+			redacted.AddAttrs(a)
+		}
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &redactingHandler{h.next.WithAttrs(h.redactAll(attrs)), h.rules}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{h.next.WithGroup(name), h.rules}
+}
+
+func (h *redactingHandler) redactAll(attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a, ok := h.redact(a); ok {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// redact returns a with the rules applied, and false if it is dropped.
+func (h *redactingHandler) redact(a slog.Attr) (slog.Attr, bool) {
+	a.Value = a.Value.Resolve()
+	for _, r := range h.rules {
+		if r.key == nil || !r.key.MatchString(a.Key) {
+			continue
+		}
+		switch r.action {
+		case ActionDrop:
+			return a, false
+		case ActionHash:
+			return slog.String(a.Key, hash(a.Value.String())), true
+		default:
+			return slog.String(a.Key, masked), true
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		attrs := h.redactAll(a.Value.Group())
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(attrs...)}, true
+	case slog.KindString:
+		return slog.String(a.Key, h.redactString(a.Value.String())), true
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, h.redactString(err.Error())), true
+		}
+	}
+	return a, true
+}
+
+func (h *redactingHandler) redactString(s string) string {
+	for _, r := range h.rules {
+		if r.value == nil {
+			continue
+		}
+		s = r.value.ReplaceAllStringFunc(s, func(match string) string {
+			switch r.action {
+			case ActionDrop:
+				return ""
+			case ActionHash:
+				return hash(match)
+			default:
+				return masked
+			}
+		})
+	}
+	return s
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
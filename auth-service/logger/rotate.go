@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000000000"
+
+type RotateConfig struct {
+	Path string `yaml:"path"`
+	// MaxSizeMB rotates the file once it would grow past this size. Zero
+	// disables size rotation.
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// Every rotates the file once it has been open this long. Zero disables
+	// time rotation.
+	Every time.Duration `yaml:"every"`
+	// MaxBackups and MaxAge bound the rotated files kept next to Path. Zero
+	// keeps them all.
+	MaxBackups int           `yaml:"max_backups"`
+	MaxAge     time.Duration `yaml:"max_age"`
+}
+
+// RotatingFile is an append-only log file that is renamed to
+// <path>.<timestamp> and reopened when it grows too large or too old.
+type RotatingFile struct {
+	config RotateConfig
+	now    func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	closed bool
+}
+
+func NewRotatingFile(config RotateConfig) (*RotatingFile, error) {
+	return newRotatingFile(config, time.Now)
+}
+
+func newRotatingFile(config RotateConfig, now func() time.Time) (*RotatingFile, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("logger: file sink needs a path")
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &RotatingFile{config: config, now: now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		// an earlier rotation could not reopen the file
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	var rotateErr error
+	if f.due(len(p)) {
+		if rotateErr = f.rotate(); f.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, errors.Join(err, rotateErr)
+}
+
+func (f *RotatingFile) due(next int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if max := int64(f.config.MaxSizeMB) << 20; max > 0 && f.size+int64(next) > max {
+		return true
+	}
+	return f.config.Every > 0 && f.now().Sub(f.opened) >= f.config.Every
+}
+
+// rotate moves the file aside and opens a new one. When the rename fails
+// the current file is reopened and written to; when nothing can be opened
+// f.file stays nil and Write tries again with the next line.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err == nil {
+		backup := f.config.Path + "." + f.now().UTC().Format(backupTimeFormat)
+		err = os.Rename(f.config.Path, backup)
+	}
+	if openErr := f.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	if err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// prune removes the backups beyond MaxBackups and those older than MaxAge.
+func (f *RotatingFile) prune() error {
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+	cutoff := f.now().Add(-f.config.MaxAge)
+	for i, backup := range backups {
+		keep := f.config.MaxBackups <= 0 || i >= len(backups)-f.config.MaxBackups
+		if keep && f.config.MaxAge > 0 {
+			stamp, err := time.Parse(backupTimeFormat, strings.TrimPrefix(backup, f.config.Path+"."))
+			keep = err != nil || stamp.After(cutoff)
+		}
+		if !keep {
+			if err := os.Remove(backup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Backups lists the rotated files, oldest first.
+func (f *RotatingFile) Backups() ([]string, error) {
+	backups, err := filepath.Glob(f.config.Path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,201 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	SinkStdout = "stdout"
+	SinkStderr = "stderr"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// SinkConfig describes one log destination. Level and Format default to the
+// logger level and JSON.
+type SinkConfig struct {
+	Type   string `yaml:"type"`
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+
+	File   RotateConfig `yaml:"file"`
+	Syslog SyslogConfig `yaml:"syslog"`
+	Async  AsyncConfig  `yaml:"async"`
+}
+
+func DefaultSinks() []SinkConfig {
+	return []SinkConfig{{Type: SinkStdout, Format: FormatJSON}}
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+func (s SinkConfig) Validate() error {
+	var errs []error
+	switch s.Type {
+	case SinkStdout, SinkStderr, SinkSyslog:
+	case SinkFile:
+		if s.File.Path == "" {
+			errs = append(errs, errors.New("file sink needs a path"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("type must be stdout, stderr, file or syslog, got %q", s.Type))
+	}
+	switch s.Format {
+	case "", FormatJSON, FormatText:
+	default:
+		errs = append(errs, fmt.Errorf("format must be json or text, got %q", s.Format))
+	}
+	if s.Level != "" {
+		if _, err := parseLevel(s.Level); err != nil {
+			errs = append(errs, fmt.Errorf("level: %w", err))
+		}
+	}
+	if s.Type == SinkSyslog {
+		if s.Syslog.Network != "udp" && s.Syslog.Network != "tcp" {
+			errs = append(errs, fmt.Errorf("syslog network must be udp or tcp, got %q", s.Syslog.Network))
+		}
+		if s.Syslog.Address == "" {
+			errs = append(errs, errors.New("syslog sink needs an address"))
+		}
+	}
+	switch s.Async.Drop {
+	case "", DropNewest, DropOldest, Block:
+	default:
+		errs = append(errs, fmt.Errorf("async drop policy must be newest, oldest or block, got %q", s.Async.Drop))
+	}
+	return errors.Join(errs...)
+}
+
+func ValidateSinks(sinks []SinkConfig) error {
+	var errs []error
+	for i, sink := range sinks {
+		if err := sink.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func replaceTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{Key: "@timestamp", Value: a.Value}
+	}
+	return a
+}
+
+// newSink builds the handler for one sink and returns the closers for
+// whatever it opened.
+func newSink(config SinkConfig, level slog.Leveler) (slog.Handler, []io.Closer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if config.Level != "" {
+		level, _ = parseLevel(config.Level)
+	}
+
+	var w io.Writer
+	var closers []io.Closer
+	switch config.Type {
+	case SinkStdout:
+		w = os.Stdout
+	case SinkStderr:
+		w = os.Stderr
+	case SinkFile:
+		file, err := NewRotatingFile(config.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closers = file, append(closers, file)
+	case SinkSyslog:
+		syslog, err := NewSyslogWriter(config.Syslog)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closers = syslog, append(closers, syslog)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceTime}
+	var handler slog.Handler
+	if config.Format == FormatText {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	if syslog, ok := w.(*SyslogWriter); ok {
+		handler = &syslogHandler{Handler: handler, w: syslog}
+	}
+	if config.Async.Enabled {
+		async, err := NewAsyncHandler(handler, config.Async)
+		if err != nil {
+			return nil, nil, err
+		}
+		handler = async
+		// flush the buffer before the writer underneath closes
+		closers = append([]io.Closer{async}, closers...)
+	}
+	return handler, closers, nil
+}
+
+// fanoutHandler sends each record to every sink enabled for its level.
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, next := range h {
+		if next.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, next := range h {
+		if next.Enabled(ctx, r.Level) {
+			if err := next.Handle(ctx, r.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, next := range h {
+		out[i] = next.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, next := range h {
+		out[i] = next.WithGroup(name)
+	}
+	return out
+}
+
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var errs []error
+	for _, closer := range c {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,276 @@
+package logger_test
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	t.Run("size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "auth.log")
+		file, err := logger.NewRotatingFile(logger.RotateConfig{Path: path, MaxSizeMB: 1, MaxBackups: 2})
+		assert.NoError(t, err)
+		defer file.Close()
+
+		chunk := []byte(strings.Repeat("x", 600<<10) + "\n")
+		for i := 0; i < 5; i++ {
+			_, err := file.Write(chunk)
+			assert.NoError(t, err)
+		}
+		backups, err := file.Backups()
+		assert.NoError(t, err)
+		assert.Len(t, backups, 2)
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(chunk)), info.Size())
+	})
+
+	t.Run("time", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "auth.log")
+		file, err := logger.NewRotatingFile(logger.RotateConfig{Path: path, Every: 20 * time.Millisecond})
+		assert.NoError(t, err)
+		defer file.Close()
+
+		file.Write([]byte("first\n"))
+		file.Write([]byte("second\n"))
+		time.Sleep(30 * time.Millisecond)
+		file.Write([]byte("third\n"))
+
+		backups, err := file.Backups()
+		assert.NoError(t, err)
+		assert.Len(t, backups, 1)
+		old, _ := os.ReadFile(backups[0])
+		assert.Equal(t, "first\nsecond\n", string(old))
+		current, _ := os.ReadFile(path)
+		assert.Equal(t, "third\n", string(current))
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "auth.log")
+		stale := path + "." + time.Now().Add(-48*time.Hour).UTC().Format("20060102T150405.000000000")
+		assert.NoError(t, os.WriteFile(stale, []byte("old\n"), 0o644))
+
+		file, err := logger.NewRotatingFile(logger.RotateConfig{Path: path, Every: time.Nanosecond, MaxAge: 24 * time.Hour})
+		assert.NoError(t, err)
+		defer file.Close()
+		file.Write([]byte("first\n"))
+		file.Write([]byte("second\n"))
+
+		backups, err := file.Backups()
+		assert.NoError(t, err)
+		assert.Len(t, backups, 1)
+		assert.NotEqual(t, stale, backups[0])
+	})
+
+	t.Run("failed rotation recovers", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "logs")
+		path := filepath.Join(dir, "auth.log")
+		file, err := logger.NewRotatingFile(logger.RotateConfig{Path: path, Every: time.Nanosecond})
+		assert.NoError(t, err)
+		defer file.Close()
+
+		_, err = file.Write([]byte("first\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.RemoveAll(dir))
+		_, err = file.Write([]byte("lost\n"))
+		assert.Error(t, err)
+
+		assert.NoError(t, os.MkdirAll(dir, 0o755))
+		_, err = file.Write([]byte("second\n"))
+		assert.NoError(t, err, "the file is reopened on the next write")
+		current, _ := os.ReadFile(path)
+		assert.Equal(t, "second\n", string(current))
+
+		assert.NoError(t, file.Close())
+		_, err = file.Write([]byte("closed\n"))
+		assert.ErrorIs(t, err, os.ErrClosed)
+	})
+}
+
+// blockingHandler holds the async worker on its first record until released.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+	seen    chan string
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{}), seen: make(chan string, 10)}
+}
+
+func (h *blockingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *blockingHandler) Handle(_ context.Context, r slog.Record) error {
+	select {
+	case h.started <- struct{}{}:
+		<-h.release
+	default:
+	}
+	h.seen <- r.Message
+	return nil
+}
+
+func (h *blockingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *blockingHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestAsyncHandler(t *testing.T) {
+	tests := []struct {
+		drop logger.DropPolicy
+		seen []string
+	}{
+		{logger.DropNewest, []string{"1", "2"}},
+		{logger.DropOldest, []string{"1", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.drop), func(t *testing.T) {
+			next := newBlockingHandler()
+			async, err := logger.NewAsyncHandler(next, logger.AsyncConfig{BufferSize: 1, Drop: tt.drop})
+			assert.NoError(t, err)
+			log := slog.New(async)
+
+			log.Info("1")
+			<-next.started
+			log.Info("2")
+			log.Info("3")
+			assert.Equal(t, uint64(1), async.Dropped())
+
+			close(next.release)
+			assert.NoError(t, async.Close())
+			close(next.seen)
+			var seen []string
+			for msg := range next.seen {
+				seen = append(seen, msg)
+			}
+			assert.Equal(t, tt.seen, seen)
+		})
+	}
+
+	_, err := logger.NewAsyncHandler(newBlockingHandler(), logger.AsyncConfig{Drop: "sometimes"})
+	assert.Error(t, err)
+}
+
+func TestSyslogSink(t *testing.T) {
+	t.Run("udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		log, closer, err := logger.NewWithConfig(logger.Config{
+			Level: slog.LevelInfo,
+			Sinks: []logger.SinkConfig{{
+				Type:   logger.SinkSyslog,
+				Format: logger.FormatText,
+				Syslog: logger.SyslogConfig{Network: "udp", Address: conn.LocalAddr().String(), AppName: "auth"},
+			}},
+		})
+		assert.NoError(t, err)
+		defer closer.Close()
+
+		log.Error("database down")
+		buf := make([]byte, 2048)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		msg := string(buf[:n])
+		assert.True(t, strings.HasPrefix(msg, "<131>1 "), msg)
+		assert.Contains(t, msg, " auth ")
+		assert.Contains(t, msg, `msg="database down"`)
+		assert.Contains(t, msg, "serviceName=auth-service")
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer ln.Close()
+
+		log, closer, err := logger.NewWithConfig(logger.Config{
+			Level:       slog.LevelInfo,
+			ServiceName: "auth-test",
+			Sinks: []logger.SinkConfig{{
+				Type:   logger.SinkSyslog,
+				Syslog: logger.SyslogConfig{Network: "tcp", Address: ln.Addr().String()},
+				Async:  logger.AsyncConfig{Enabled: true},
+			}},
+		})
+		assert.NoError(t, err)
+
+		conn, err := ln.Accept()
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		log.Warn("slow query")
+		assert.NoError(t, closer.Close())
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		frame, err := bufio.NewReader(conn).ReadString('>')
+		assert.NoError(t, err)
+		assert.Regexp(t, `^\d+ <132>$`, frame)
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		w, err := logger.NewSyslogWriter(logger.SyslogConfig{Network: "tcp", Address: ln.Addr().String(), Timeout: time.Second})
+		assert.NoError(t, err)
+		defer w.Close()
+		conn, err := ln.Accept()
+		assert.NoError(t, err)
+		conn.Close()
+		ln.Close()
+
+		// the kernel may take a few writes to notice the peer is gone
+		for i := 0; i < 50 && err == nil; i++ {
+			_, err = w.Write([]byte("lost\n"))
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Error(t, err)
+
+		start := time.Now()
+		_, err = w.Write([]byte("dropped\n"))
+		assert.ErrorIs(t, err, logger.ErrSyslogDisconnected, "lines are dropped until the redial backoff passes")
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+}
+
+func TestSinks(t *testing.T) {
+	dir := t.TempDir()
+	log, closer, err := logger.NewWithConfig(logger.Config{
+		Level:       slog.LevelDebug,
+		ServiceName: "auth-test",
+		Sinks: []logger.SinkConfig{
+			{Type: logger.SinkFile, File: logger.RotateConfig{Path: filepath.Join(dir, "all.log")}},
+			{Type: logger.SinkFile, Level: "error", Format: logger.FormatText, File: logger.RotateConfig{Path: filepath.Join(dir, "error.log")}},
+		},
+		Redact: logger.DefaultRedactRules(),
+	})
+	assert.NoError(t, err)
+	defer slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	log.Debug("cache miss", "id", "user-1")
+	log.Error("login failed", "password", "hunter2")
+	assert.NoError(t, closer.Close())
+
+	all, _ := os.ReadFile(filepath.Join(dir, "all.log"))
+	lines := strings.Split(strings.TrimSpace(string(all)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"@timestamp"`)
+	assert.Contains(t, lines[0], `"serviceName":"auth-test"`)
+	assert.NotContains(t, string(all), "hunter2")
+
+	errors, _ := os.ReadFile(filepath.Join(dir, "error.log"))
+	assert.Equal(t, 1, strings.Count(string(errors), "\n"))
+	assert.Contains(t, string(errors), `level=ERROR msg="login failed"`)
+
+	_, _, err = logger.NewWithConfig(logger.Config{Sinks: []logger.SinkConfig{{Type: "kafka"}, {Type: logger.SinkFile, Format: "xml"}}})
+	assert.Error(t, err)
+}
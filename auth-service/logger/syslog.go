@@ -0,0 +1,182 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type SyslogConfig struct {
+	// Network is udp or tcp.
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	// Facility is the numeric syslog facility, 16 (local0) by default.
+	Facility int    `yaml:"facility"`
+	AppName  string `yaml:"app_name"`
+	// Timeout bounds each dial and write, 2s by default.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+const (
+	syslogRedialBackoff    = time.Second
+	syslogMaxRedialBackoff = time.Minute
+)
+
+// ErrSyslogDisconnected is returned for lines dropped while the syslog
+// server is unreachable and the writer waits to redial.
+var ErrSyslogDisconnected = errors.New("logger: syslog disconnected")
+
+// SyslogWriter sends each Write as one RFC 5424 message. Messages sent over
+// TCP use octet-counting framing (RFC 6587). After a failed dial or write the
+// connection is redialed with backoff; lines written in between are dropped,
+// so a dead server costs callers at most one Timeout per backoff.
+type SyslogWriter struct {
+	config   SyslogConfig
+	hostname string
+
+	// handle serializes syslogHandler.Handle so the severity it sets is the
+	// one its line is sent with.
+	handle   sync.Mutex
+	mu       sync.Mutex
+	conn     net.Conn
+	severity int
+	backoff  time.Duration
+	redialAt time.Time
+}
+
+func NewSyslogWriter(config SyslogConfig) (*SyslogWriter, error) {
+	switch config.Network {
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("logger: syslog network must be udp or tcp, got %q", config.Network)
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("logger: syslog sink needs an address")
+	}
+	if config.Facility == 0 {
+		config.Facility = 16
+	}
+	if config.AppName == "" {
+		config.AppName = "-"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	w := &SyslogWriter{config: config, hostname: hostname, severity: severity(slog.LevelInfo)}
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *SyslogWriter) dial() error {
+	conn, err := net.DialTimeout(w.config.Network, w.config.Address, w.config.Timeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// severity maps slog levels onto syslog severities.
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.write(w.severity, p)
+}
+
+func (w *SyslogWriter) write(severity int, p []byte) (int, error) {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "<%d>1 %s %s %s %d - - ",
+		w.config.Facility*8+severity, time.Now().UTC().Format(time.RFC3339Nano), w.hostname, w.config.AppName, os.Getpid())
+	msg.Write(bytes.TrimRight(p, "\n"))
+
+	frame := msg.Bytes()
+	if w.config.Network == "tcp" {
+		frame = append([]byte(fmt.Sprintf("%d ", msg.Len())), frame...)
+	}
+	if w.conn == nil {
+		if time.Now().Before(w.redialAt) {
+			return 0, ErrSyslogDisconnected
+		}
+		if err := w.dial(); err != nil {
+			w.disconnected()
+			return 0, err
+		}
+		w.backoff = 0
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(w.config.Timeout))
+	if _, err := w.conn.Write(frame); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.disconnected()
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// disconnected schedules the next redial, doubling the wait each time it
+// fails in a row.
+func (w *SyslogWriter) disconnected() {
+	w.backoff = min(max(2*w.backoff, syslogRedialBackoff), syslogMaxRedialBackoff)
+	w.redialAt = time.Now().Add(w.backoff)
+}
+
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslogHandler sets the message severity from the record level before the
+// wrapped handler writes the line.
+type syslogHandler struct {
+	slog.Handler
+	w *SyslogWriter
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.handle.Lock()
+	defer h.w.handle.Unlock()
+
+	h.w.mu.Lock()
+	h.w.severity = severity(r.Level)
+	h.w.mu.Unlock()
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
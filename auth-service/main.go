@@ -2,62 +2,244 @@ package main
 
 import (
 	"context"
+	"log/slog"
 	"os"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/sing3demons/auth-service/audit"
+	"github.com/sing3demons/auth-service/changestream"
+	"github.com/sing3demons/auth-service/config"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/health"
+	"github.com/sing3demons/auth-service/keys"
 	"github.com/sing3demons/auth-service/logger"
+	"github.com/sing3demons/auth-service/metrics"
 	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/outbox"
 	"github.com/sing3demons/auth-service/redis"
 	"github.com/sing3demons/auth-service/router"
+	"github.com/sing3demons/auth-service/sqlstore"
 	"github.com/sing3demons/auth-service/store"
+	"github.com/sing3demons/auth-service/tracing"
 	"github.com/sing3demons/auth-service/user"
+	"github.com/sing3demons/auth-service/webhook"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func init() {
-	if os.Getenv("ENV") != "production" {
-		if err := godotenv.Load(".env.dev"); err != nil {
-			panic(err)
-		}
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
 
+	var logLevel slog.LevelVar
+	logLevel.Set(cfg.Level())
+	logger, logSinks, err := logger.NewWithConfig(logger.Config{
+		Level:       &logLevel,
+		ServiceName: cfg.ServiceName,
+		Sinks:       cfg.LogSinks,
+		Redact:      cfg.Redact,
+	})
+	if err != nil {
+		panic(err)
 	}
-}
+	defer logSinks.Close()
+	logger.Info("Starting the application...", "config", cfg.String())
 
-func main() {
-	port := os.Getenv("PORT")
+	tokens := user.NewTokens(cfg.Tokens)
+	reloader := config.NewReloader(cfg, config.Reread, logger)
+	reloader.OnReload(func(cfg *config.Config) {
+		logLevel.Set(cfg.Level())
+		tokens.Store(cfg.Tokens)
+	})
+	go reloader.Watch(context.Background(), 5*time.Second)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
 
-	logger := logger.New()
-	logger.Info("Starting the application...")
+	keyring, err := loadKeyring(context.Background(), cfg.Keys)
+	if err != nil {
+		panic(err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
-	db := store.NewStore(ctx)
-	defer db.Disconnect(ctx)
+	var repository user.UserRepository
+	var recorder audit.Recorder = audit.Discard
+	var auditLog *audit.Log
+	var box *outbox.Outbox
+	var hooks *webhook.Manager
+	var changes *changestream.Consumer
+	var pingDB func(ctx context.Context) error
+	switch cfg.Store.Driver {
+	case "sqlite", "postgres":
+		sqlDB, err := sqlstore.Open(ctx, sqlstore.Dialect(cfg.Store.Driver), string(cfg.Store.SQLDSN))
+		if err != nil {
+			panic(err)
+		}
+		defer sqlDB.Close()
+		if err := sqlDB.Migrate(ctx); err != nil {
+			panic(err)
+		}
+		repository = user.NewSQLUserRepository(sqlDB)
+		pingDB = sqlDB.PingContext
+		logger.Warn("The audit log needs the mongo or memory store; security events are not recorded")
+	default:
+		var db store.Store
+		if cfg.Store.Driver == "memory" {
+			logger.Info("Using in-memory store")
+			db = store.NewMemoryStore()
+		} else {
+			db = store.New(store.NewStore(ctx, string(cfg.Store.MongoURI)))
+		}
+		db = store.NewInstrumented(db)
+		defer db.Disconnect(ctx)
+		repository = user.NewMongoUserRepositoryWithConfig(db, cfg.Store.MongoRepositoryConfig())
+		auditLog = audit.NewLog(db, cfg.Store.AuditConfig())
+		recorder = auditLog
+		box = outbox.New(db, cfg.Store.OutboxConfig())
+		if err := box.EnsureIndexes(ctx); err != nil {
+			panic(err)
+		}
+		hookConfig := cfg.Store.WebhookConfig()
+		hookConfig.Format, hookConfig.Source = cfg.Events.Format, cfg.Events.Source
+		hooks = webhook.New(db, hookConfig)
+		if cfg.ChangeStream.Enabled {
+			streamConfig := cfg.ChangeStreamConfig()
+			if streamConfig.Name == "" {
+				streamConfig.Name, _ = os.Hostname()
+			}
+			tokens := changestream.NewMongoTokenStore(db, cfg.Store.ResumeTokenConfig())
+			changes = changestream.NewConsumer(changestream.Watch(db), tokens, streamConfig, logger)
+		}
+		pingDB = func(ctx context.Context) error {
+			return db.Ping(ctx, readpref.Primary())
+		}
+	}
 
-	redisClient := redis.New()
+	var redisClient redis.IRedis
+	if cfg.Redis.Driver == "memory" {
+		logger.Info("Using in-memory redis")
+		redisClient = redis.NewMemory()
+	} else {
+		opts, err := cfg.Redis.Options()
+		if err != nil {
+			panic(err)
+		}
+		if redisClient, err = redis.NewWithOptions(ctx, opts); err != nil {
+			panic(err)
+		}
+	}
+	redisClient = redis.NewInstrumented(redisClient)
 	defer redisClient.Close()
 
-	r := router.New()
-	r.Use(mlog.Middleware(logger))
-	r.GET("/healthz", func(c *gin.Context) {
-		if err := db.Ping(ctx, readpref.Primary()); err != nil {
-			logger.Error(err.Error())
-			c.JSON(500, "MongoDB is not available")
-			return
-		}
+	if cfg.Store.CacheTTL > 0 {
+		repository = user.NewCachedUserRepository(repository, redisClient, cfg.Store.CacheTTL)
+	}
+
+	r, err := router.NewWithTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	r.Use(tracing.Middleware(), mlog.Middleware(logger), mlog.AccessLog(cfg.AccessLog), metrics.Middleware(), audit.Middleware())
+	metrics.Register(r)
 
+	checks := health.NewRegistry()
+	checks.Register("database", health.CheckerFunc(pingDB))
+	checks.Register("redis", health.CheckerFunc(func(ctx context.Context) error {
 		_, err := redisClient.Ping(ctx)
-		if err != nil {
-			logger.Error(err.Error())
-			c.JSON(500, "Internal Server Error")
-			return
+		return err
+	}))
+	health.Register(r, checks)
+
+	publisher, err := events.NewPublisher(cfg.Events)
+	if err != nil {
+		panic(err)
+	}
+	defer publisher.Close()
+
+	if hooks != nil {
+		dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+		defer stopDispatch()
+		go webhook.NewDispatcher(hooks, nil, cfg.Webhooks, logger).Run(dispatchCtx)
+		publisher = events.Multi(publisher, hooks)
+	}
+
+	if cfg.Events.Delivery == events.DeliveryOutbox && box == nil {
+		panic("events delivery outbox needs the mongo or memory store")
+	}
+	// deletes seen on the change stream always go through the outbox, which
+	// keeps one copy of each however many replicas publish it
+	if cfg.Events.Delivery == events.DeliveryOutbox || changes != nil {
+		relayCtx, stopRelay := context.WithCancel(context.Background())
+		defer stopRelay()
+		go outbox.NewRelay(box, publisher, cfg.Outbox, logger).Run(relayCtx)
+	}
+	if cfg.Events.Delivery == events.DeliveryOutbox {
+		publisher = box
+	}
+
+	if changes != nil {
+		if cached, ok := repository.(*user.CachedUserRepository); ok {
+			changes.Subscribe(cached)
 		}
-		c.JSON(200, "OK")
-	})
+		changes.Subscribe(user.PublishDeletes(box))
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go func() {
+			if err := changes.Run(watchCtx); err != nil {
+				logger.Error("change stream stopped", "error", err)
+			}
+		}()
+	}
+
+	user.Register(r, repository, redisClient, keyring, user.Config{HostURL: cfg.HostURL, Tokens: tokens, Audit: recorder, Events: publisher}, logger)
+	if auditLog != nil {
+		audit.Register(r, auditLog, user.Authorization(keyring), user.RequireRole(repository, "admin"))
+	}
+	if hooks != nil {
+		webhook.Register(r, hooks, user.Authorization(keyring), user.RequireRole(repository, "admin"))
+	}
+
+	r.StartHTTP(cfg.Port)
+}
 
-	user.Register(r, db, redisClient, logger)
+// loadKeyring picks where signing keys come from: file reads PEM files from
+// the key directory, dir serves versioned keys from it, kms signs through the
+// key management service, and env reads base64 PEM from the environment.
+func loadKeyring(ctx context.Context, cfg config.Keys) (keys.Keyring, error) {
+	switch cfg.Source {
+	case "file":
+		return keys.LoadWithAlgorithms(keys.NewFileSource(cfg.Dir), cfg.Algorithms)
+	case "dir":
+		return keys.NewDirKeyring(cfg.Dir, cfg.Algorithms)
+	case "kms":
+		kms, err := newKMS(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return keys.NewKMSKeyring(ctx, kms, cfg.KMS.AccessKeyID, cfg.KMS.RefreshKeyID, cfg.Algorithms)
+	default:
+		return keys.LoadWithAlgorithms(keys.EnvSource{}, cfg.Algorithms)
+	}
+}
 
-	r.StartHTTP(port)
+// newKMS returns the key management service behind KEY_SOURCE=kms. Only the
+// in-memory KMS exists so far: it generates the configured keys at startup,
+// so tokens do not survive a restart or verify across replicas. Config
+// validation rejects it in production.
+func newKMS(cfg config.Keys) (keys.KMS, error) {
+	kms := keys.NewFakeKMS()
+	if err := kms.CreateKey(cfg.KMS.AccessKeyID, cfg.Algorithms.For(keys.Access)); err != nil {
+		return nil, err
+	}
+	if cfg.KMS.RefreshKeyID != cfg.KMS.AccessKeyID {
+		if err := kms.CreateKey(cfg.KMS.RefreshKeyID, cfg.Algorithms.For(keys.Refresh)); err != nil {
+			return nil, err
+		}
+	}
+	return kms, nil
 }
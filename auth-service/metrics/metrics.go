@@ -0,0 +1,161 @@
+// Package metrics defines the service's Prometheus collectors and serves
+// them on /metrics.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sing3demons/auth-service/router"
+)
+
+const namespace = "auth"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	tokensIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Tokens issued by type and format.",
+	}, []string{"type", "format"})
+
+	tokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "Refresh token exchanges by result.",
+	}, []string{"result"})
+
+	tokenVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_verifications_total",
+		Help:      "Access token verifications by result.",
+	}, []string{"result"})
+
+	redisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_operation_duration_seconds",
+		Help:      "Redis operation latency by operation and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation", "result"})
+
+	mongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_operation_duration_seconds",
+		Help:      "Mongo operation latency by collection, operation and result.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"collection", "operation", "result"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	bcryptDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bcrypt_duration_seconds",
+		Help:      "Time spent hashing and comparing passwords.",
+		Buckets:   []float64{.01, .025, .05, .1, .2, .4, .8, 1.6},
+	}, []string{"operation"})
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+func result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+func LoginSucceeded() {
+	logins.WithLabelValues(ResultSuccess, "").Inc()
+}
+
+func LoginFailed(reason string) {
+	logins.WithLabelValues(ResultFailure, reason).Inc()
+}
+
+func TokenIssued(tokenType, format string) {
+	tokensIssued.WithLabelValues(tokenType, format).Inc()
+}
+
+func TokenRefreshed(err error) {
+	tokenRefreshes.WithLabelValues(result(err)).Inc()
+}
+
+func TokenVerified(err error) {
+	tokenVerifications.WithLabelValues(result(err)).Inc()
+}
+
+// ObserveRedis records a Redis operation that started at start.
+func ObserveRedis(operation string, start time.Time, err error) {
+	redisDuration.WithLabelValues(operation, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveMongo records a Mongo operation that started at start.
+func ObserveMongo(collection, operation string, start time.Time, err error) {
+	mongoDuration.WithLabelValues(collection, operation, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// CacheLookup counts a lookup in the named cache.
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveBcrypt records a bcrypt hash or compare that started at start.
+func ObserveBcrypt(operation string, start time.Time) {
+	bcryptDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// Middleware counts and times every request by its route pattern, so path
+// parameters do not multiply the series. Unrouted requests share one label.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Register serves the default Prometheus registry on /metrics.
+func Register(r router.MyRouter) router.MyRouter {
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	return r
+}
@@ -0,0 +1,99 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sing3demons/auth-service/metrics"
+	"github.com/sing3demons/auth-service/router"
+	"github.com/stretchr/testify/assert"
+)
+
+// value returns the current value of the counter or the sample count of the
+// histogram name with exactly labels, or 0 if there is none.
+func value(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metric:
+		for _, m := range family.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, label := range m.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metric
+				}
+			}
+			if m.GetHistogram() != nil {
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func get(r router.MyRouter, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	r.(http.Handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := router.New()
+	r.Use(metrics.Middleware())
+	metrics.Register(r)
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	route := map[string]string{"method": "GET", "route": "/users/:id", "status": "200"}
+	unmatched := map[string]string{"method": "GET", "route": "unmatched", "status": "404"}
+	before, beforeUnmatched := value(t, "auth_http_requests_total", route), value(t, "auth_http_requests_total", unmatched)
+
+	get(r, "/users/1")
+	get(r, "/users/2")
+	get(r, "/nowhere")
+
+	assert.Equal(t, before+2, value(t, "auth_http_requests_total", route))
+	assert.Equal(t, beforeUnmatched+1, value(t, "auth_http_requests_total", unmatched))
+	assert.Equal(t, before+2, value(t, "auth_http_request_duration_seconds", map[string]string{"method": "GET", "route": "/users/:id"}))
+
+	recorder := get(r, "/metrics")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `auth_http_requests_total{method="GET",route="/users/:id",status="200"}`)
+}
+
+func TestAuthCounters(t *testing.T) {
+	failure := map[string]string{"result": "failure", "reason": "invalid_password"}
+	before := value(t, "auth_logins_total", failure)
+	metrics.LoginFailed("invalid_password")
+	assert.Equal(t, before+1, value(t, "auth_logins_total", failure))
+
+	issued := map[string]string{"type": "access", "format": "jwt"}
+	before = value(t, "auth_tokens_issued_total", issued)
+	metrics.TokenIssued("access", "jwt")
+	assert.Equal(t, before+1, value(t, "auth_tokens_issued_total", issued))
+
+	hit := map[string]string{"cache": "user", "result": "hit"}
+	before = value(t, "auth_cache_lookups_total", hit)
+	metrics.CacheLookup("user", true)
+	assert.Equal(t, before+1, value(t, "auth_cache_lookups_total", hit))
+
+	recorder := httptest.NewRecorder()
+	r := router.New()
+	metrics.Register(r)
+	r.(http.Handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"auth_logins_total", "auth_tokens_issued_total"} {
+		assert.True(t, strings.Contains(recorder.Body.String(), name), name)
+	}
+}
@@ -0,0 +1,82 @@
+package mlog
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserIDKey is the gin context key under which authentication stores the
+// caller's user ID for the access log.
+const UserIDKey = "user_id"
+
+type AccessLogConfig struct {
+	// SampleRate is the fraction of requests logged, from 0 to 1. Server
+	// errors are always logged.
+	SampleRate float64 `yaml:"sample_rate"`
+	// Skip lists request paths that are never logged.
+	Skip []string `yaml:"skip"`
+}
+
+func DefaultAccessLogConfig() AccessLogConfig {
+	return AccessLogConfig{
+		SampleRate: 1,
+		Skip:       []string{"/healthz", "/livez", "/readyz", "/metrics"},
+	}
+}
+
+// AccessLog writes one line per request to the request logger. It must run
+// after Middleware.
+func AccessLog(config AccessLogConfig) gin.HandlerFunc {
+	skip := make(map[string]bool, len(config.Skip))
+	for _, path := range config.Skip {
+		skip[path] = true
+	}
+	return func(c *gin.Context) {
+		if skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < 500 && !sampled(config.SampleRate) {
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start))/float64(time.Millisecond)),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("request_id", RequestID(c.Request.Context())),
+		}
+		if userID := c.GetString(UserIDKey); userID != "" {
+			attrs = append(attrs, slog.String("user_id", userID))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		ctx := c.Request.Context()
+		L(ctx).LogAttrs(ctx, level, "access", attrs...)
+	}
+}
+
+func sampled(rate float64) bool {
+	return rate >= 1 || rate > 0 && rand.Float64() < rate
+}
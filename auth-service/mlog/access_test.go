@@ -0,0 +1,114 @@
+package mlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func accessLog(t *testing.T, config mlog.AccessLogConfig) (router.MyRouter, *bytes.Buffer) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	r := router.New()
+	r.Use(mlog.Middleware(slog.New(slog.NewJSONHandler(&logs, nil))), mlog.AccessLog(config))
+	r.GET("/users/:id", func(c *gin.Context) {
+		c.Set(mlog.UserIDKey, "user-1")
+		c.String(http.StatusOK, "hello")
+	})
+	r.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fail", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+	return r, &logs
+}
+
+func request(r router.MyRouter, path string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	r.(http.Handler).ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func lines(t *testing.T, logs *bytes.Buffer) []map[string]any {
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		out = append(out, entry)
+	}
+	return out
+}
+
+func TestAccessLog(t *testing.T) {
+	r, logs := accessLog(t, mlog.DefaultAccessLogConfig())
+	request(r, "/users/42")
+	request(r, "/healthz")
+	request(r, "/fail")
+
+	entries := lines(t, logs)
+	assert.Len(t, entries, 2)
+
+	entry := entries[0]
+	assert.Equal(t, "access", entry["msg"])
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/users/:id", entry["route"])
+	assert.Equal(t, "/users/42", entry["path"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Equal(t, float64(len("hello")), entry["bytes"])
+	assert.Equal(t, "user-1", entry["user_id"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.NotEmpty(t, entry["client_ip"])
+	assert.Contains(t, entry, "latency_ms")
+
+	assert.Equal(t, "ERROR", entries[1]["level"])
+	assert.NotContains(t, entries[1], "user_id")
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	r, logs := accessLog(t, mlog.AccessLogConfig{SampleRate: 0})
+	request(r, "/users/42")
+	request(r, "/healthz")
+	request(r, "/fail")
+
+	entries := lines(t, logs)
+	assert.Len(t, entries, 1, "server errors are logged regardless of sampling")
+	assert.Equal(t, "/fail", entries[0]["route"])
+}
+
+func TestAccessLogClientIP(t *testing.T) {
+	forged := func(r router.MyRouter) {
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		r.(http.Handler).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	r, logs := accessLog(t, mlog.DefaultAccessLogConfig())
+	forged(r)
+	assert.Equal(t, "192.0.2.1", lines(t, logs)[0]["client_ip"], "no proxy is trusted by default")
+
+	var buf bytes.Buffer
+	trusted, err := router.NewWithTrustedProxies([]string{"192.0.2.0/24"})
+	assert.NoError(t, err)
+	trusted.Use(mlog.Middleware(slog.New(slog.NewJSONHandler(&buf, nil))), mlog.AccessLog(mlog.DefaultAccessLogConfig()))
+	trusted.GET("/users/:id", func(c *gin.Context) {})
+	forged(trusted)
+	assert.Equal(t, "203.0.113.9", lines(t, &buf)[0]["client_ip"])
+
+	_, err = router.NewWithTrustedProxies([]string{"proxy"})
+	assert.Error(t, err)
+}
@@ -15,8 +15,10 @@ const (
 	loggerKey  contextKey = "logger"
 )
 
+const HeaderRequestID = "X-Request-ID"
+
 func logMiddleware(ctx context.Context, logger *slog.Logger) *slog.Logger {
-	session, exits := ctx.Value(loggerKey).(string)
+	session, exits := ctx.Value(sessionKey).(string)
 	if !exits {
 		session = uuid.New().String()
 	}
@@ -24,6 +26,20 @@ func logMiddleware(ctx context.Context, logger *slog.Logger) *slog.Logger {
 	return logger
 }
 
+// WithRequestID returns a copy of ctx carrying id as its request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey).(string)
+	return id
+}
+
+// Middleware takes the request ID from x-request-id, then x-session-id, or
+// generates one. It is stored in the request context, added to the request
+// logger and echoed as X-Request-ID on the response.
 func Middleware(logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := c.GetHeader("x-request-id")
@@ -35,7 +51,8 @@ func Middleware(logger *slog.Logger) gin.HandlerFunc {
 				session = uuid.New().String()
 			}
 		}
-		ctx := context.WithValue(c.Request.Context(), sessionKey, session)
+		c.Header(HeaderRequestID, session)
+		ctx := WithRequestID(c.Request.Context(), session)
 		l := logMiddleware(ctx, logger)
 		ctx = context.WithValue(ctx, loggerKey, l)
 		c.Request = c.Request.WithContext(ctx)
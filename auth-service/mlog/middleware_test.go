@@ -0,0 +1,87 @@
+package mlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	r := router.New()
+	r.Use(mlog.Middleware(slog.New(slog.NewJSONHandler(&logs, nil))))
+
+	var requestID string
+	r.GET("/", func(c *gin.Context) {
+		requestID = mlog.RequestID(c.Request.Context())
+		mlog.L(c.Request.Context()).Info("handled")
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		recorder := httptest.NewRecorder()
+		r.(http.Handler).ServeHTTP(recorder, req)
+		return recorder
+	}
+	session := func() string {
+		var line map[string]any
+		assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+		return line["session"].(string)
+	}
+
+	recorder := serve("X-Request-ID", "req-1")
+	assert.Equal(t, "req-1", recorder.Header().Get(mlog.HeaderRequestID))
+	assert.Equal(t, "req-1", requestID)
+	assert.Equal(t, "req-1", session())
+
+	recorder = serve("X-Session-ID", "session-1")
+	assert.Equal(t, "session-1", recorder.Header().Get(mlog.HeaderRequestID))
+	assert.Equal(t, "session-1", session())
+
+	recorder = serve("", "")
+	generated := recorder.Header().Get(mlog.HeaderRequestID)
+	assert.NotEmpty(t, generated)
+	assert.Equal(t, generated, requestID)
+	assert.Equal(t, generated, session())
+}
+
+func TestTransport(t *testing.T) {
+	var received []string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(mlog.HeaderRequestID))
+	}))
+	defer downstream.Close()
+	client := &http.Client{Transport: mlog.NewTransport(nil)}
+
+	ctx := mlog.WithRequestID(context.Background(), "req-1")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+	_, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Empty(t, req.Header.Get(mlog.HeaderRequestID), "the caller's request is not modified")
+
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+	req.Header.Set(mlog.HeaderRequestID, "explicit")
+	_, err = client.Do(req)
+	assert.NoError(t, err)
+
+	req, _ = http.NewRequest(http.MethodGet, downstream.URL, nil)
+	_, err = client.Do(req)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"req-1", "explicit", ""}, received)
+}
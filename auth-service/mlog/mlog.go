@@ -3,14 +3,19 @@ package mlog
 import (
 	"context"
 	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+// L returns the request logger stored in ctx, or the default logger. When
+// ctx carries a span, every line is tagged with its trace_id and span_id.
 func L(ctx context.Context) *slog.Logger {
-	logger := ctx.Value(loggerKey)
-	switch logger := logger.(type) {
-	case *slog.Logger:
-		return logger
-	default:
-		return slog.Default()
+	logger, ok := ctx.Value(loggerKey).(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		logger = logger.With("trace_id", span.TraceID().String(), "span_id", span.SpanID().String())
 	}
+	return logger
 }
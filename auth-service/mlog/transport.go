@@ -0,0 +1,28 @@
+package mlog
+
+import "net/http"
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// NewTransport forwards the request ID of each outbound request's context
+// as X-Request-ID, unless the request already sets it. A nil base uses
+// http.DefaultTransport.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := RequestID(req.Context())
+	if id == "" || req.Header.Get(HeaderRequestID) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set(HeaderRequestID, id)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,230 @@
+// Package outbox makes event delivery follow the database: events are
+// written to an outbox collection in the same transaction as the change they
+// describe, and a Relay later delivers them to the broker. Delivery is at
+// least once; consumers should drop duplicates by event ID.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultDatabase   = "auth"
+	DefaultCollection = "outbox"
+)
+
+type Config struct {
+	Database   string
+	Collection string
+	// Sequences holds the per-subject counters that number the records;
+	// it defaults to Collection with a "_sequences" suffix.
+	Sequences string
+}
+
+// Record is an event waiting for, or done with, delivery. Seq numbers the
+// records of one subject from 1 in the order they were committed. A dead
+// record ran out of delivery attempts and no longer holds back its subject.
+type Record struct {
+	ID          string      `bson:"_id"`
+	Seq         int64       `bson:"seq"`
+	Type        events.Type `bson:"type"`
+	Version     int         `bson:"version"`
+	Subject     string      `bson:"subject"`
+	Time        time.Time   `bson:"time"`
+	Data        string      `bson:"data"`
+	Delivered   bool        `bson:"delivered"`
+	DeliveredAt time.Time   `bson:"delivered_at,omitempty"`
+	Dead        bool        `bson:"dead,omitempty"`
+	Attempts    int         `bson:"attempts"`
+	NextAttempt time.Time   `bson:"next_attempt"`
+	LeaseUntil  time.Time   `bson:"lease_until"`
+	LastError   string      `bson:"last_error,omitempty"`
+}
+
+// Event rebuilds the event the record was made from. Data stays encoded.
+func (r Record) Event() events.Event {
+	return events.Event{
+		ID:      r.ID,
+		Type:    r.Type,
+		Version: r.Version,
+		Subject: r.Subject,
+		Time:    r.Time,
+		Data:    json.RawMessage(r.Data),
+	}
+}
+
+// Outbox is an events.Publisher that stores events instead of sending them.
+type Outbox struct {
+	store  store.Store
+	config Config
+}
+
+func New(client store.Store, config Config) *Outbox {
+	if config.Database == "" {
+		config.Database = DefaultDatabase
+	}
+	if config.Collection == "" {
+		config.Collection = DefaultCollection
+	}
+	if config.Sequences == "" {
+		config.Sequences = config.Collection + "_sequences"
+	}
+	return &Outbox{store: client, config: config}
+}
+
+func (o *Outbox) collection() store.Collection {
+	return o.store.Database(o.config.Database).Collection(o.config.Collection)
+}
+
+func (o *Outbox) sequences() store.Collection {
+	return o.store.Database(o.config.Database).Collection(o.config.Sequences)
+}
+
+// EnsureIndexes creates the indexes the relay's queries use: one finds the
+// pending records that are due, the other the head of each subject.
+func (o *Outbox) EnsureIndexes(ctx context.Context) error {
+	err := store.EnsureIndexes(ctx, o.collection(),
+		mongo.IndexModel{Keys: bson.D{{Key: "delivered", Value: 1}, {Key: "next_attempt", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "subject", Value: 1}, {Key: "delivered", Value: 1}, {Key: "seq", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "delivered", Value: 1}, {Key: "delivered_at", Value: 1}}},
+	)
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
+
+// Transaction runs fn in a transaction. Writes made with the ctx fn is given,
+// including Publish, commit or roll back together.
+func (o *Outbox) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return store.WithTransaction(ctx, o.store, fn)
+}
+
+// pending matches the records still waiting for delivery.
+func pending() bson.M {
+	return bson.M{"delivered": false, "dead": bson.M{"$ne": true}}
+}
+
+// Publish stores events in the outbox. Inside Transaction they are only
+// relayed if the transaction commits; otherwise Publish runs in a
+// transaction of its own. Each record takes the next number of its
+// subject's counter in that transaction, so concurrent writers cannot
+// interleave a subject's records.
+//
+// Events are keyed by ID and an event that is already stored is skipped, so
+// replicas that each see the same change can all publish it and it is
+// relayed once.
+func (o *Outbox) Publish(ctx context.Context, evts ...events.Event) error {
+	if len(evts) == 0 {
+		return nil
+	}
+	return o.Transaction(ctx, func(ctx context.Context) error {
+		fresh, err := o.unstored(ctx, evts)
+		if err != nil {
+			return err
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+
+		counts := map[string]int64{}
+		for _, event := range fresh {
+			counts[event.Subject]++
+		}
+		next := make(map[string]int64, len(counts))
+		for subject, count := range counts {
+			last, err := o.reserve(ctx, subject, count)
+			if err != nil {
+				return err
+			}
+			next[subject] = last - count + 1
+		}
+
+		docs := make([]interface{}, 0, len(fresh))
+		for _, event := range fresh {
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				return fmt.Errorf("outbox: %s: %w", event.Type, err)
+			}
+			docs = append(docs, Record{
+				ID:      event.ID,
+				Seq:     next[event.Subject],
+				Type:    event.Type,
+				Version: event.Version,
+				Subject: event.Subject,
+				Time:    event.Time,
+				Data:    string(data),
+			})
+			next[event.Subject]++
+		}
+		if _, err := o.collection().InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+		return nil
+	})
+}
+
+// unstored drops the events whose ID is already in the outbox. A write
+// error would abort the transaction, so duplicates are filtered out before
+// inserting rather than ignored after.
+func (o *Outbox) unstored(ctx context.Context, evts []events.Event) ([]events.Event, error) {
+	ids := make([]string, 0, len(evts))
+	for _, event := range evts {
+		ids = append(ids, event.ID)
+	}
+	cursor, err := o.collection().Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	var stored []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	seen := make(map[string]bool, len(stored))
+	for _, record := range stored {
+		seen[record.ID] = true
+	}
+
+	fresh := make([]events.Event, 0, len(evts))
+	for _, event := range evts {
+		if !seen[event.ID] {
+			seen[event.ID] = true
+			fresh = append(fresh, event)
+		}
+	}
+	return fresh, nil
+}
+
+// reserve adds count to the sequence counter of subject and returns its new
+// value. The counter document stays locked until the transaction ends, which
+// is what keeps concurrent publishers for one subject in order.
+func (o *Outbox) reserve(ctx context.Context, subject string, count int64) (int64, error) {
+	_, err := o.sequences().UpdateOne(ctx, bson.M{"_id": subject},
+		bson.M{"$inc": bson.M{"seq": count}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	if err := o.sequences().FindOne(ctx, bson.M{"_id": subject}).Decode(&counter); err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+func (o *Outbox) Close() error {
+	return nil
+}
@@ -0,0 +1,267 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/outbox"
+	"github.com/sing3demons/auth-service/store"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// flakySink fails every publish for the subjects in down.
+type flakySink struct {
+	mu        sync.Mutex
+	down      map[string]bool
+	published []events.Event
+}
+
+func (s *flakySink) Publish(ctx context.Context, evts ...events.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range evts {
+		if s.down[event.Subject] {
+			return errors.New("broker down")
+		}
+	}
+	s.published = append(s.published, evts...)
+	return nil
+}
+
+func (s *flakySink) Close() error {
+	return nil
+}
+
+func (s *flakySink) subjects() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subjects := []string{}
+	for _, event := range s.published {
+		subjects = append(subjects, event.Subject+":"+string(event.Type))
+	}
+	return subjects
+}
+
+func records(t *testing.T, db store.Store) []outbox.Record {
+	cursor, err := db.Database(outbox.DefaultDatabase).Collection(outbox.DefaultCollection).Find(context.TODO(), bson.M{})
+	assert.NoError(t, err)
+	var all []outbox.Record
+	assert.NoError(t, cursor.All(context.TODO(), &all))
+	return all
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	box := outbox.New(db, outbox.Config{})
+	users := db.Database("auth").Collection("users")
+
+	err := box.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := users.InsertOne(ctx, bson.M{"_id": "u1"}); err != nil {
+			return err
+		}
+		if err := box.Publish(ctx, events.New(events.UserRegistered, "u1", events.Registered{ID: "u1"})); err != nil {
+			return err
+		}
+		return errors.New("validation failed")
+	})
+	assert.EqualError(t, err, "validation failed")
+	assert.Empty(t, records(t, db))
+	assert.ErrorIs(t, users.FindOne(ctx, bson.M{"_id": "u1"}).Err(), mongo.ErrNoDocuments)
+
+	err = box.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := users.InsertOne(ctx, bson.M{"_id": "u1"}); err != nil {
+			return err
+		}
+		return box.Publish(ctx, events.New(events.UserRegistered, "u1", events.Registered{ID: "u1", Email: "a@example.com"}))
+	})
+	assert.NoError(t, err)
+	stored := records(t, db)
+	assert.Len(t, stored, 1)
+	assert.False(t, stored[0].Delivered)
+	assert.Equal(t, "u1", stored[0].Subject)
+
+	var data events.Registered
+	assert.NoError(t, json.Unmarshal(stored[0].Event().Data.(json.RawMessage), &data))
+	assert.Equal(t, "a@example.com", data.Email)
+
+	// replicas publishing the same event store it once
+	again := stored[0].Event()
+	assert.NoError(t, box.Publish(ctx, again, events.New(events.UserLoggedIn, "u1", events.LoggedIn{ID: "u1"})))
+	assert.Len(t, records(t, db), 2)
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	box := outbox.New(db, outbox.Config{})
+	sink := &flakySink{down: map[string]bool{"u1": true}}
+	relay := outbox.NewRelay(box, sink, outbox.RelayConfig{Backoff: 20 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}, slog.Default())
+
+	assert.NoError(t, box.Publish(ctx,
+		events.New(events.UserRegistered, "u1", events.Registered{ID: "u1"}),
+		events.New(events.UserRegistered, "u2", events.Registered{ID: "u2"}),
+		events.New(events.UserProfileUpdated, "u1", events.ProfileUpdated{ID: "u1"}),
+		events.New(events.UserProfileUpdated, "u2", events.ProfileUpdated{ID: "u2"}),
+	))
+
+	// u1 is held back after its first failure; u2 carries on
+	delivered, err := relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []string{"u2:user.registered", "u2:user.profile_updated"}, sink.subjects())
+
+	for _, record := range records(t, db) {
+		if record.Subject == "u1" && record.Type == events.UserRegistered {
+			assert.Equal(t, 1, record.Attempts)
+			assert.Equal(t, "broker down", record.LastError)
+			assert.True(t, record.NextAttempt.After(time.Now()))
+		}
+	}
+
+	// not retried before the backoff
+	sink.mu.Lock()
+	sink.down = nil
+	sink.mu.Unlock()
+	delivered, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	time.Sleep(30 * time.Millisecond)
+	delivered, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []string{
+		"u2:user.registered", "u2:user.profile_updated",
+		"u1:user.registered", "u1:user.profile_updated",
+	}, sink.subjects())
+
+	delivered, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, delivered, "delivered records are not sent again")
+}
+
+func TestSequence(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	box := outbox.New(db, outbox.Config{})
+
+	assert.NoError(t, box.Publish(ctx,
+		events.New(events.UserRegistered, "u1", events.Registered{ID: "u1"}),
+		events.New(events.UserRegistered, "u2", events.Registered{ID: "u2"}),
+		events.New(events.UserProfileUpdated, "u1", events.ProfileUpdated{ID: "u1"}),
+	))
+	assert.NoError(t, box.Transaction(ctx, func(ctx context.Context) error {
+		return box.Publish(ctx, events.New(events.UserLoggedIn, "u1", events.LoggedIn{ID: "u1"}))
+	}))
+
+	seqs := map[string][]int64{}
+	for _, record := range records(t, db) {
+		seqs[record.Subject] = append(seqs[record.Subject], record.Seq)
+	}
+	assert.Equal(t, map[string][]int64{"u1": {1, 2, 3}, "u2": {1}}, seqs)
+}
+
+func TestRelayStuckSubject(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	box := outbox.New(db, outbox.Config{})
+	sink := &flakySink{down: map[string]bool{"u1": true}}
+	relay := outbox.NewRelay(box, sink, outbox.RelayConfig{BatchSize: 2, Backoff: time.Minute, MaxAttempts: 2}, slog.Default())
+
+	start := time.Now().Add(-time.Minute)
+	for i, subject := range []string{"u1", "u1", "u1", "u2"} {
+		event := events.New(events.UserLoggedIn, subject, events.LoggedIn{ID: subject})
+		event.Time = start.Add(time.Duration(i) * time.Second)
+		assert.NoError(t, box.Publish(ctx, event))
+	}
+
+	// the first batch is all u1, whose head fails
+	delivered, err := relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	// u1 now waits for its backoff and is left out of the batch
+	delivered, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, []string{"u2:user.logged_in"}, sink.subjects())
+}
+
+func TestRelayDeadRecord(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	box := outbox.New(db, outbox.Config{})
+	sink := &flakySink{down: map[string]bool{"u1": true}}
+	relay := outbox.NewRelay(box, sink, outbox.RelayConfig{MaxAttempts: 1}, slog.Default())
+
+	assert.NoError(t, box.Publish(ctx, events.New(events.UserRegistered, "u1", events.Registered{ID: "u1"})))
+	assert.NoError(t, box.Publish(ctx, events.New(events.UserProfileUpdated, "u1", events.ProfileUpdated{ID: "u1"})))
+
+	delivered, err := relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	sink.mu.Lock()
+	sink.down = nil
+	sink.mu.Unlock()
+	delivered, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered, "a dead record no longer holds back its subject")
+	assert.Equal(t, []string{"u1:user.profile_updated"}, sink.subjects())
+
+	for _, record := range records(t, db) {
+		if record.Type == events.UserRegistered {
+			assert.True(t, record.Dead)
+			assert.False(t, record.Delivered)
+			assert.Equal(t, "broker down", record.LastError)
+		}
+	}
+}
+
+func TestRelayLease(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	box := outbox.New(db, outbox.Config{})
+	assert.NoError(t, box.Publish(ctx, events.New(events.UserDeleted, "u1", events.Deleted{ID: "u1"})))
+
+	// another relay is delivering the record
+	_, err := db.Database(outbox.DefaultDatabase).Collection(outbox.DefaultCollection).UpdateMany(ctx, bson.M{},
+		bson.M{"$set": bson.M{"lease_until": time.Now().Add(time.Minute)}})
+	assert.NoError(t, err)
+
+	sink := events.NewMemory()
+	delivered, err := outbox.NewRelay(box, sink, outbox.RelayConfig{}, slog.Default()).RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Empty(t, sink.Events())
+}
+
+func TestCleanup(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	box := outbox.New(db, outbox.Config{})
+	relay := outbox.NewRelay(box, events.NewMemory(), outbox.RelayConfig{Retention: 10 * time.Millisecond}, slog.Default())
+
+	assert.NoError(t, box.Publish(ctx, events.New(events.UserRegistered, "u1", events.Registered{ID: "u1"})))
+	_, err := relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, box.Publish(ctx, events.New(events.UserRegistered, "u2", events.Registered{ID: "u2"})))
+
+	time.Sleep(20 * time.Millisecond)
+	deleted, err := relay.Cleanup(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	left := records(t, db)
+	assert.Len(t, left, 1)
+	assert.Equal(t, "u2", left[0].Subject, "pending records are kept")
+}
@@ -0,0 +1,277 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/sing3demons/auth-service/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RelayConfig struct {
+	// Interval is how often the outbox is polled.
+	Interval  time.Duration `yaml:"interval"`
+	BatchSize int64         `yaml:"batch_size"`
+	// Backoff doubles after every failed attempt up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// MaxAttempts is how often a record is tried before it is marked dead,
+	// which lets the rest of its subject through.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Lease is how long a relay owns a record it is delivering, so relays in
+	// other instances skip it.
+	Lease time.Duration `yaml:"lease"`
+	// Retention is how long delivered records are kept before cleanup.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		Interval:    time.Second,
+		BatchSize:   100,
+		Backoff:     time.Second,
+		MaxBackoff:  5 * time.Minute,
+		MaxAttempts: 20,
+		Lease:       30 * time.Second,
+		Retention:   24 * time.Hour,
+	}
+}
+
+// Relay delivers outbox records to a sink in Seq order per subject. A
+// failed delivery holds back the later records of the same subject until a
+// retry succeeds or the record is marked dead; other subjects carry on.
+type Relay struct {
+	outbox *Outbox
+	sink   events.Publisher
+	config RelayConfig
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+func NewRelay(outbox *Outbox, sink events.Publisher, config RelayConfig, logger *slog.Logger) *Relay {
+	defaults := DefaultRelayConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaults.Backoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaults.Lease
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaults.Retention
+	}
+	return &Relay{outbox: outbox, sink: sink, config: config, logger: logger, now: time.Now}
+}
+
+// Run relays and cleans up every Interval until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayOnce(ctx); err != nil {
+			r.logger.Error("outbox relay failed", "error", err)
+		}
+		if _, err := r.Cleanup(ctx); err != nil {
+			r.logger.Error("outbox cleanup failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce delivers one batch of pending records and returns how many were
+// delivered. Failed deliveries are scheduled for retry, not returned as
+// errors.
+//
+// Subjects whose head record is waiting for a retry or leased by another
+// relay are left out of the batch, so a stuck subject's backlog cannot fill
+// it. Each remaining subject is delivered from its head in Seq order.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	now := r.now()
+	held, err := r.heldSubjects(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	filter := pending()
+	filter["next_attempt"] = bson.M{"$lte": now}
+	filter["lease_until"] = bson.M{"$lte": now}
+	filter["subject"] = bson.M{"$nin": held}
+	cursor, err := r.outbox.collection().Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "seq", Value: 1}}).SetLimit(r.config.BatchSize))
+	if err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	var due []Record
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+
+	var subjects []string
+	bySubject := map[string][]Record{}
+	for _, record := range due {
+		if _, ok := bySubject[record.Subject]; !ok {
+			subjects = append(subjects, record.Subject)
+		}
+		bySubject[record.Subject] = append(bySubject[record.Subject], record)
+	}
+
+	delivered := 0
+	for _, subject := range subjects {
+		records := bySubject[subject]
+		slices.SortFunc(records, func(a, b Record) int { return cmp.Compare(a.Seq, b.Seq) })
+		for i, record := range records {
+			// the record after one just delivered is the new head
+			if i == 0 || record.Seq != records[i-1].Seq+1 {
+				head, err := r.isHead(ctx, record)
+				if err != nil {
+					return delivered, err
+				}
+				if !head {
+					break
+				}
+			}
+			ok, err := r.deliver(ctx, record)
+			if err != nil {
+				return delivered, err
+			}
+			if !ok {
+				break
+			}
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// heldSubjects lists the subjects whose head record cannot be delivered
+// yet: it failed and waits for its backoff, or another relay holds its
+// lease. Only heads are ever tried, so only heads match.
+func (r *Relay) heldSubjects(ctx context.Context, now time.Time) ([]string, error) {
+	filter := pending()
+	filter["$or"] = bson.A{
+		bson.M{"next_attempt": bson.M{"$gt": now}},
+		bson.M{"lease_until": bson.M{"$gt": now}},
+	}
+	cursor, err := r.outbox.collection().Find(ctx, filter, options.Find().SetProjection(bson.M{"subject": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	var held []Record
+	if err := cursor.All(ctx, &held); err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	subjects := make([]string, 0, len(held))
+	for _, record := range held {
+		subjects = append(subjects, record.Subject)
+	}
+	return subjects, nil
+}
+
+// isHead reports whether record is the oldest pending record of its
+// subject.
+func (r *Relay) isHead(ctx context.Context, record Record) (bool, error) {
+	filter := pending()
+	filter["subject"] = record.Subject
+	filter["seq"] = bson.M{"$lt": record.Seq}
+	err := r.outbox.collection().FindOne(ctx, filter).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("outbox: %w", err)
+	}
+	return false, nil
+}
+
+// deliver reports whether record was delivered. It returns an error only
+// when the outbox itself cannot be updated.
+func (r *Relay) deliver(ctx context.Context, record Record) (bool, error) {
+	now := r.now()
+	if record.NextAttempt.After(now) {
+		return false, nil
+	}
+
+	// take the lease; another relay holding it wins
+	claim := pending()
+	claim["_id"] = record.ID
+	claim["lease_until"] = bson.M{"$lte": now}
+	claimed, err := r.outbox.collection().UpdateOne(ctx, claim,
+		bson.M{"$set": bson.M{"lease_until": now.Add(r.config.Lease)}})
+	if err != nil {
+		return false, fmt.Errorf("outbox: %w", err)
+	}
+	if claimed.MatchedCount == 0 {
+		return false, nil
+	}
+
+	if publishErr := r.sink.Publish(ctx, record.Event()); publishErr != nil {
+		record.Attempts++
+		set := bson.M{
+			"attempts":    record.Attempts,
+			"last_error":  publishErr.Error(),
+			"lease_until": time.Time{},
+		}
+		if record.Attempts >= r.config.MaxAttempts {
+			// give up so the rest of the subject is not held back for good
+			r.logger.Error("outbox delivery failed, record is dead", "id", record.ID, "type", record.Type,
+				"subject", record.Subject, "attempts", record.Attempts, "error", publishErr)
+			set["dead"] = true
+		} else {
+			backoff := r.config.Backoff << min(record.Attempts-1, 20)
+			if backoff > r.config.MaxBackoff || backoff <= 0 {
+				backoff = r.config.MaxBackoff
+			}
+			r.logger.Warn("outbox delivery failed", "id", record.ID, "type", record.Type,
+				"attempts", record.Attempts, "retry_in", backoff.String(), "error", publishErr)
+			set["next_attempt"] = now.Add(backoff)
+		}
+		if _, err := r.outbox.collection().UpdateOne(ctx, bson.M{"_id": record.ID}, bson.M{"$set": set}); err != nil {
+			return false, fmt.Errorf("outbox: %w", err)
+		}
+		return false, nil
+	}
+
+	_, err = r.outbox.collection().UpdateOne(ctx, bson.M{"_id": record.ID}, bson.M{"$set": bson.M{
+		"delivered":    true,
+		"delivered_at": r.now(),
+		"lease_until":  time.Time{},
+	}})
+	if err != nil {
+		return false, fmt.Errorf("outbox: %w", err)
+	}
+	return true, nil
+}
+
+// Cleanup deletes records delivered more than Retention ago.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	result, err := r.outbox.collection().DeleteMany(ctx, bson.M{
+		"delivered":    true,
+		"delivered_at": bson.M{"$lt": r.now().Add(-r.config.Retention)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("outbox: %w", err)
+	}
+	return result.DeletedCount, nil
+}
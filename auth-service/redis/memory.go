@@ -0,0 +1,240 @@
+package redis
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const janitorInterval = time.Minute
+
+var errInvalidExpire = errors.New("ERR invalid expire time in 'setex' command")
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// memory is an in-process IRedis for single-node development and tests.
+// Keys expire lazily on access and are swept periodically until Close.
+type memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	closed  bool
+	done    chan struct{}
+}
+
+func NewMemory() IRedis {
+	m := &memory{
+		entries: map[string]memoryEntry{},
+		done:    make(chan struct{}),
+	}
+	go m.janitor()
+	return m
+}
+
+func (m *memory) janitor() {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for k, e := range m.entries {
+				if e.expired(now) {
+					delete(m.entries, k)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// get must be called with m.mu held.
+func (m *memory) get(key string) (memoryEntry, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if e.expired(time.Now()) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, true
+}
+
+func (m *memory) Ping(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", redis.ErrClosed
+	}
+	return "PONG", ctx.Err()
+}
+
+func (m *memory) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return m.set(ctx, key, value, expiration)
+}
+
+func (m *memory) SetEx(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if expiration <= 0 {
+		return errInvalidExpire
+	}
+	return m.set(ctx, key, value, expiration)
+}
+
+func (m *memory) set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s, err := formatValue(value)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return redis.ErrClosed
+	}
+
+	e := memoryEntry{value: s}
+	switch {
+	case expiration == redis.KeepTTL:
+		if old, ok := m.get(key); ok {
+			e.expiresAt = old.expiresAt
+		}
+	case expiration > 0:
+		e.expiresAt = time.Now().Add(expiration)
+	}
+	m.entries[key] = e
+	return nil
+}
+
+func (m *memory) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", redis.ErrClosed
+	}
+
+	e, ok := m.get(key)
+	if !ok {
+		return "", redis.Nil
+	}
+	return e.value, nil
+}
+
+func (m *memory) Del(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return redis.ErrClosed
+	}
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *memory) Exists(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, redis.ErrClosed
+	}
+
+	if _, ok := m.get(key); ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return redis.ErrClosed
+	}
+	m.closed = true
+	close(m.done)
+	return nil
+}
+
+// formatValue mirrors how go-redis writes command arguments, so values read
+// back from memory match what a real server would return.
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf(
+			"redis: can't marshal %T (implement encoding.BinaryMarshaler)", value)
+	}
+}
@@ -0,0 +1,84 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/sing3demons/auth-service/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		r := redis.NewMemory()
+		defer r.Close()
+
+		assert.NoError(t, r.Set(ctx, "key", 42, 0))
+		v, err := r.Get(ctx, "key")
+		assert.NoError(t, err)
+		assert.Equal(t, "42", v)
+
+		_, err = r.Get(ctx, "missing")
+		assert.ErrorIs(t, err, goredis.Nil)
+	})
+
+	t.Run("SetEx expires", func(t *testing.T) {
+		r := redis.NewMemory()
+		defer r.Close()
+
+		assert.NoError(t, r.SetEx(ctx, "token", "true", 20*time.Millisecond))
+		n, err := r.Exists(ctx, "token")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		time.Sleep(30 * time.Millisecond)
+		n, err = r.Exists(ctx, "token")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+
+		assert.Error(t, r.SetEx(ctx, "token", "true", 0))
+	})
+
+	t.Run("Del", func(t *testing.T) {
+		r := redis.NewMemory()
+		defer r.Close()
+
+		assert.NoError(t, r.Set(ctx, "key", "value", time.Minute))
+		assert.NoError(t, r.Del(ctx, "key"))
+		n, _ := r.Exists(ctx, "key")
+		assert.Equal(t, int64(0), n)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		r := redis.NewMemory()
+		assert.NoError(t, r.Close())
+
+		_, err := r.Ping(ctx)
+		assert.ErrorIs(t, err, goredis.ErrClosed)
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		r := redis.NewMemory()
+		defer r.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := fmt.Sprintf("key-%d", i%5)
+				r.SetEx(ctx, key, i, time.Minute)
+				r.Get(ctx, key)
+				r.Exists(ctx, key)
+				r.Del(ctx, key)
+			}(i)
+		}
+		wg.Wait()
+	})
+}
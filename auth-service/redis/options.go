@@ -0,0 +1,265 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Mode string
+
+const (
+	ModeStandalone Mode = "standalone"
+	ModeSentinel   Mode = "sentinel"
+	ModeCluster    Mode = "cluster"
+)
+
+// Options describes how to reach Redis in any of the supported topologies.
+// Addrs holds the server address in standalone mode, the sentinel addresses
+// in sentinel mode and the seed nodes in cluster mode.
+type Options struct {
+	Mode       Mode
+	Addrs      []string
+	MasterName string
+
+	Username string
+	Password string
+	DB       int
+
+	SentinelUsername string
+	SentinelPassword string
+
+	TLS *tls.Config
+
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+func (o Options) Validate() error {
+	if len(o.Addrs) == 0 {
+		return errors.New("redis: at least one address is required")
+	}
+	switch o.Mode {
+	case ModeStandalone:
+		if len(o.Addrs) != 1 {
+			return fmt.Errorf("redis: standalone mode takes one address, got %d", len(o.Addrs))
+		}
+	case ModeSentinel:
+		if o.MasterName == "" {
+			return errors.New("redis: sentinel mode requires a master name")
+		}
+	case ModeCluster:
+		if o.DB != 0 {
+			return errors.New("redis: cluster mode does not support selecting a database")
+		}
+	default:
+		return fmt.Errorf("redis: unknown mode %q", o.Mode)
+	}
+	return nil
+}
+
+func (o Options) client() redis.UniversalClient {
+	switch o.Mode {
+	case ModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       o.MasterName,
+			SentinelAddrs:    o.Addrs,
+			SentinelUsername: o.SentinelUsername,
+			SentinelPassword: o.SentinelPassword,
+			Username:         o.Username,
+			Password:         o.Password,
+			DB:               o.DB,
+			TLSConfig:        o.TLS,
+			PoolSize:         o.PoolSize,
+			MinIdleConns:     o.MinIdleConns,
+			DialTimeout:      o.DialTimeout,
+			ReadTimeout:      o.ReadTimeout,
+			WriteTimeout:     o.WriteTimeout,
+		})
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        o.Addrs,
+			Username:     o.Username,
+			Password:     o.Password,
+			TLSConfig:    o.TLS,
+			PoolSize:     o.PoolSize,
+			MinIdleConns: o.MinIdleConns,
+			DialTimeout:  o.DialTimeout,
+			ReadTimeout:  o.ReadTimeout,
+			WriteTimeout: o.WriteTimeout,
+		})
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:         o.Addrs[0],
+			Username:     o.Username,
+			Password:     o.Password,
+			DB:           o.DB,
+			TLSConfig:    o.TLS,
+			PoolSize:     o.PoolSize,
+			MinIdleConns: o.MinIdleConns,
+			DialTimeout:  o.DialTimeout,
+			ReadTimeout:  o.ReadTimeout,
+			WriteTimeout: o.WriteTimeout,
+		})
+	}
+}
+
+// ParseURI reads connection options from a URI. A bare "host:port" is
+// accepted for backwards compatibility. Supported forms are
+//
+//	redis://[user:pass@]host:port[/db]
+//	redis+sentinel://[user:pass@]host1:port,host2:port/master[/db]
+//	redis+cluster://[user:pass@]host1:port,host2:port
+//
+// Each scheme also has a "rediss" variant that enables TLS. The query string
+// may set pool_size, min_idle_conns, dial_timeout, read_timeout,
+// write_timeout, sentinel_username, sentinel_password, ca_file and
+// insecure_skip_verify.
+func ParseURI(uri string) (Options, error) {
+	scheme, rest, found := strings.Cut(uri, "://")
+	if !found {
+		if uri == "" {
+			return Options{}, errors.New("redis: empty URI")
+		}
+		return Options{Mode: ModeStandalone, Addrs: []string{uri}}, nil
+	}
+
+	o := Options{}
+	switch scheme {
+	case "redis", "rediss":
+		o.Mode = ModeStandalone
+	case "redis+sentinel", "rediss+sentinel":
+		o.Mode = ModeSentinel
+	case "redis+cluster", "rediss+cluster":
+		o.Mode = ModeCluster
+	default:
+		return Options{}, fmt.Errorf("redis: unsupported scheme %q", scheme)
+	}
+	secure := strings.HasPrefix(scheme, "rediss")
+
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	authority, path, _ := strings.Cut(rest, "/")
+
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userinfo, err := url.Parse("//" + authority[:i+1] + "host")
+		if err != nil {
+			return Options{}, fmt.Errorf("redis: invalid credentials: %w", err)
+		}
+		o.Username = userinfo.User.Username()
+		o.Password, _ = userinfo.User.Password()
+		authority = authority[i+1:]
+	}
+
+	for _, addr := range strings.Split(authority, ",") {
+		if addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, ":") {
+			if o.Mode == ModeSentinel {
+				addr += ":26379"
+			} else {
+				addr += ":6379"
+			}
+		}
+		o.Addrs = append(o.Addrs, addr)
+	}
+
+	segments := []string{}
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	if o.Mode == ModeSentinel && len(segments) > 0 {
+		o.MasterName = segments[0]
+		segments = segments[1:]
+	}
+	if len(segments) > 1 {
+		return Options{}, fmt.Errorf("redis: invalid path %q", path)
+	}
+	if len(segments) == 1 {
+		db, err := strconv.Atoi(segments[0])
+		if err != nil {
+			return Options{}, fmt.Errorf("redis: invalid database number %q", segments[0])
+		}
+		o.DB = db
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Options{}, fmt.Errorf("redis: invalid query: %w", err)
+	}
+	if err := o.applyQuery(query, secure); err != nil {
+		return Options{}, err
+	}
+
+	return o, o.Validate()
+}
+
+func (o *Options) applyQuery(q url.Values, secure bool) error {
+	var err error
+	intParam := func(name string, dst *int) {
+		if v := q.Get(name); v != "" && err == nil {
+			if *dst, err = strconv.Atoi(v); err != nil {
+				err = fmt.Errorf("redis: invalid %s %q", name, v)
+			}
+		}
+	}
+	durationParam := func(name string, dst *time.Duration) {
+		if v := q.Get(name); v != "" && err == nil {
+			if *dst, err = time.ParseDuration(v); err != nil {
+				err = fmt.Errorf("redis: invalid %s %q", name, v)
+			}
+		}
+	}
+
+	intParam("pool_size", &o.PoolSize)
+	intParam("min_idle_conns", &o.MinIdleConns)
+	durationParam("dial_timeout", &o.DialTimeout)
+	durationParam("read_timeout", &o.ReadTimeout)
+	durationParam("write_timeout", &o.WriteTimeout)
+	if err != nil {
+		return err
+	}
+
+	o.SentinelUsername = q.Get("sentinel_username")
+	o.SentinelPassword = q.Get("sentinel_password")
+
+	if !secure {
+		return nil
+	}
+	o.TLS, err = tlsConfig(q.Get("ca_file"), q.Get("insecure_skip_verify") == "true")
+	return err
+}
+
+func tlsConfig(caFile string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure,
+	}
+	if caFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("redis: read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("redis: no certificates found in %s", caFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
@@ -3,7 +3,6 @@ package redis
 import (
 	"context"
 	"log"
-	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -19,46 +18,48 @@ type IRedis interface {
 	Close() error
 }
 
-type cacher struct{ *redis.Client }
+type cacher struct{ redis.UniversalClient }
 
-func New() IRedis {
-	uri := os.Getenv("REDIS_URI")
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: uri,
-	})
-	cmd, err := redisClient.Ping(context.Background()).Result()
+func NewWithOptions(ctx context.Context, opts Options) (IRedis, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	redisClient := opts.client()
+	cmd, err := redisClient.Ping(ctx).Result()
 	if err != nil {
-		panic(err)
+		redisClient.Close()
+		return nil, err
 	}
-	log.Println("redis connected", cmd)
+	log.Println("redis connected", opts.Mode, cmd)
 
-	return &cacher{redisClient}
+	return &cacher{redisClient}, nil
 }
 
 func (c *cacher) Close() error {
-	return c.Client.Close()
+	return c.UniversalClient.Close()
 }
 
 func (c *cacher) Ping(ctx context.Context) (string, error) {
-	return c.Client.Ping(ctx).Result()
+	return c.UniversalClient.Ping(ctx).Result()
 }
 
 func (c *cacher) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return c.Client.Set(ctx, key, value, expiration).Err()
+	return c.UniversalClient.Set(ctx, key, value, expiration).Err()
 }
 
 func (c *cacher) Get(ctx context.Context, key string) (string, error) {
-	return c.Client.Get(ctx, key).Result()
+	return c.UniversalClient.Get(ctx, key).Result()
 }
 
 func (c *cacher) Del(ctx context.Context, key string) error {
-	return c.Client.Del(ctx, key).Err()
+	return c.UniversalClient.Del(ctx, key).Err()
 }
 
 func (c *cacher) Exists(ctx context.Context, key string) (int64, error) {
-	return c.Client.Exists(ctx, key).Result()
+	return c.UniversalClient.Exists(ctx, key).Result()
 }
 
 func (c *cacher) SetEx(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return c.Client.SetEx(ctx, key, value, expiration).Err()
+	return c.UniversalClient.SetEx(ctx, key, value, expiration).Err()
 }
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sing3demons/auth-service/metrics"
+	"github.com/sing3demons/auth-service/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type instrumented struct {
+	IRedis
+	tracer trace.Tracer
+}
+
+// NewInstrumented traces every call to next and records its latency and
+// result. A Get of a missing key counts as a success.
+func NewInstrumented(next IRedis) IRedis {
+	return &instrumented{next, tracing.Tracer("redis")}
+}
+
+func (i *instrumented) start(ctx context.Context, operation string) (context.Context, func(*error)) {
+	begin := time.Now()
+	ctx, span := i.tracer.Start(ctx, "redis "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(operation)))
+	return ctx, func(err *error) {
+		var result error
+		if !errors.Is(*err, redis.Nil) {
+			result = *err
+		}
+		metrics.ObserveRedis(operation, begin, result)
+		tracing.End(span, result)
+	}
+}
+
+func (i *instrumented) Ping(ctx context.Context) (pong string, err error) {
+	ctx, end := i.start(ctx, "ping")
+	defer end(&err)
+	return i.IRedis.Ping(ctx)
+}
+
+func (i *instrumented) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) (err error) {
+	ctx, end := i.start(ctx, "set")
+	defer end(&err)
+	return i.IRedis.Set(ctx, key, value, expiration)
+}
+
+func (i *instrumented) Get(ctx context.Context, key string) (value string, err error) {
+	ctx, end := i.start(ctx, "get")
+	defer end(&err)
+	return i.IRedis.Get(ctx, key)
+}
+
+func (i *instrumented) Del(ctx context.Context, key string) (err error) {
+	ctx, end := i.start(ctx, "del")
+	defer end(&err)
+	return i.IRedis.Del(ctx, key)
+}
+
+func (i *instrumented) Exists(ctx context.Context, key string) (n int64, err error) {
+	ctx, end := i.start(ctx, "exists")
+	defer end(&err)
+	return i.IRedis.Exists(ctx, key)
+}
+
+func (i *instrumented) SetEx(ctx context.Context, key string, value interface{}, expiration time.Duration) (err error) {
+	ctx, end := i.start(ctx, "setex")
+	defer end(&err)
+	return i.IRedis.SetEx(ctx, key, value, expiration)
+}
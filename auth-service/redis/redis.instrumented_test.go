@@ -0,0 +1,50 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sing3demons/auth-service/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleCount(t *testing.T, operation, result string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "auth_redis_operation_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["operation"] == operation && labels["result"] == result {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestInstrumented(t *testing.T) {
+	ctx := context.Background()
+	memory := redis.NewMemory()
+	defer memory.Close()
+	client := redis.NewInstrumented(memory)
+
+	setex, get := sampleCount(t, "setex", "success"), sampleCount(t, "get", "success")
+
+	assert.NoError(t, client.SetEx(ctx, "key", "value", time.Minute))
+	value, err := client.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	_, err = client.Get(ctx, "missing")
+	assert.Error(t, err)
+
+	assert.Equal(t, setex+1, sampleCount(t, "setex", "success"))
+	assert.Equal(t, get+2, sampleCount(t, "get", "success"), "a missing key is not a failure")
+}
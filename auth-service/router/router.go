@@ -28,12 +28,25 @@ type myRouter struct {
 	*gin.Engine
 }
 
+// New returns a router that trusts no proxy: ClientIP is the address of the
+// connection, so clients cannot set it with X-Forwarded-For.
 func New() MyRouter {
+	r, _ := NewWithTrustedProxies(nil)
+	return r
+}
+
+// NewWithTrustedProxies returns a router that takes the client IP from
+// X-Forwarded-For and X-Real-IP only when the request comes from one of
+// proxies, given as IPs or CIDRs.
+func NewWithTrustedProxies(proxies []string) (MyRouter, error) {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		return nil, err
+	}
 
 	r.Use(gin.Recovery())
-	return &myRouter{r}
+	return &myRouter{r}, nil
 }
 
 func (m *myRouter) GET(relativePath string, handlers ...gin.HandlerFunc) {
@@ -0,0 +1,147 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+type migration struct {
+	version int
+	name    string
+	up      map[Dialect][]string
+}
+
+// migrations are applied in order and must never be edited once released;
+// add a new entry instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create users",
+		up: map[Dialect][]string{
+			SQLite: {
+				`CREATE TABLE users (
+					id          TEXT PRIMARY KEY,
+					username    TEXT UNIQUE,
+					email       TEXT UNIQUE,
+					password    TEXT NOT NULL,
+					name        TEXT NOT NULL DEFAULT '',
+					roles       TEXT NOT NULL DEFAULT '[]',
+					first_name  TEXT NOT NULL DEFAULT '',
+					last_name   TEXT NOT NULL DEFAULT '',
+					description TEXT NOT NULL DEFAULT '',
+					phone       TEXT NOT NULL DEFAULT '',
+					address     TEXT NOT NULL DEFAULT '',
+					update_date TEXT NOT NULL DEFAULT '',
+					create_at   TIMESTAMP NOT NULL,
+					update_at   TIMESTAMP NOT NULL
+				)`,
+			},
+			Postgres: {
+				`CREATE TABLE users (
+					id          TEXT PRIMARY KEY,
+					username    TEXT UNIQUE,
+					email       TEXT UNIQUE,
+					password    TEXT NOT NULL,
+					name        TEXT NOT NULL DEFAULT '',
+					roles       TEXT NOT NULL DEFAULT '[]',
+					first_name  TEXT NOT NULL DEFAULT '',
+					last_name   TEXT NOT NULL DEFAULT '',
+					description TEXT NOT NULL DEFAULT '',
+					phone       TEXT NOT NULL DEFAULT '',
+					address     TEXT NOT NULL DEFAULT '',
+					update_date TEXT NOT NULL DEFAULT '',
+					create_at   TIMESTAMPTZ NOT NULL,
+					update_at   TIMESTAMPTZ NOT NULL
+				)`,
+			},
+		},
+	},
+	{
+		version: 2,
+		name:    "create profile languages",
+		up: map[Dialect][]string{
+			SQLite: {
+				`CREATE TABLE profile_languages (
+					id            TEXT NOT NULL UNIQUE,
+					user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+					language_code TEXT NOT NULL,
+					first_name    TEXT NOT NULL DEFAULT '',
+					last_name     TEXT NOT NULL DEFAULT '',
+					description   TEXT NOT NULL DEFAULT '',
+					attachments   TEXT NOT NULL DEFAULT '[]',
+					create_date   TEXT NOT NULL DEFAULT '',
+					update_date   TEXT NOT NULL DEFAULT '',
+					PRIMARY KEY (user_id, language_code)
+				)`,
+			},
+			Postgres: {
+				`CREATE TABLE profile_languages (
+					id            TEXT NOT NULL UNIQUE,
+					user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+					language_code TEXT NOT NULL,
+					first_name    TEXT NOT NULL DEFAULT '',
+					last_name     TEXT NOT NULL DEFAULT '',
+					description   TEXT NOT NULL DEFAULT '',
+					attachments   TEXT NOT NULL DEFAULT '[]',
+					create_date   TEXT NOT NULL DEFAULT '',
+					update_date   TEXT NOT NULL DEFAULT '',
+					PRIMARY KEY (user_id, language_code)
+				)`,
+			},
+		},
+	},
+}
+
+// Migrate brings the schema up to date. Each migration runs in its own
+// transaction together with its schema_migrations row, so a failed step
+// leaves the database at the previous version.
+func (db *DB) Migrate(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("sqlstore: create schema_migrations: %w", err)
+	}
+
+	for _, m := range migrations {
+		if err := db.WithTx(ctx, func(tx *sql.Tx) error {
+			return db.apply(ctx, tx, m)
+		}); err != nil {
+			return fmt.Errorf("sqlstore: migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) apply(ctx context.Context, tx *sql.Tx, m migration) error {
+	if db.Dialect == Postgres {
+		// Serialize replicas migrating the same database at boot.
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(7203940121)`); err != nil {
+			return err
+		}
+	}
+
+	var applied int
+	if err := tx.QueryRowContext(ctx, db.Rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	for _, stmt := range m.up[db.Dialect] {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, db.Rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`), m.version, m.name, time.Now().UTC()); err != nil {
+		return err
+	}
+	log.Println("applied migration", m.version, m.name)
+	return nil
+}
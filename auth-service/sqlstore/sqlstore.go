@@ -0,0 +1,121 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+func (d Dialect) driver() (string, error) {
+	switch d {
+	case SQLite:
+		return "sqlite", nil
+	case Postgres:
+		return "pgx", nil
+	default:
+		return "", fmt.Errorf("sqlstore: unsupported dialect %q", d)
+	}
+}
+
+// DB is a *sql.DB that knows which dialect it speaks. Queries are written
+// with "?" placeholders and rebound for the target database.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+func Open(ctx context.Context, dialect Dialect, dsn string) (*DB, error) {
+	driver, err := dialect.driver()
+	if err != nil {
+		return nil, err
+	}
+	if dsn == "" {
+		return nil, errors.New("sqlstore: empty DSN")
+	}
+
+	if dialect == SQLite {
+		dsn = sqliteDSN(dsn)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == SQLite {
+		// SQLite allows a single writer; one connection avoids SQLITE_BUSY
+		// and keeps ":memory:" databases shared.
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Println("Connected to", dialect)
+
+	return &DB{DB: db, Dialect: dialect}, nil
+}
+
+// sqliteDSN turns on foreign keys, which SQLite leaves off by default, so
+// that ON DELETE CASCADE and REFERENCES hold as they do in Postgres. A DSN
+// that sets foreign_keys itself is left alone.
+func sqliteDSN(dsn string) string {
+	if strings.Contains(dsn, "foreign_keys") {
+		return dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "_pragma=foreign_keys(1)"
+}
+
+// Rebind rewrites "?" placeholders into the dialect's native form.
+func (db *DB) Rebind(query string) string {
+	if db.Dialect != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// WithTx runs fn inside a transaction, committing when fn returns nil and
+// rolling back otherwise.
+func (db *DB) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,693 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+var ErrChangeStreamNotSupported = errors.New("store: change streams are not supported by the memory store")
+
+// MemoryStore is an in-process Store used by tests and local development.
+// Documents are kept as bson.M and every read returns a copy, so callers see
+// the same decode behaviour they would get from a real server.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	databases map[string]map[string]*memoryCollection
+	sessions  int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{databases: map[string]map[string]*memoryCollection{}}
+}
+
+func (s *MemoryStore) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Ping(ctx context.Context, rp *readpref.ReadPref) error {
+	return ctx.Err()
+}
+
+func (s *MemoryStore) ListDatabases(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) (mongo.ListDatabasesResult, error) {
+	names, err := s.ListDatabaseNames(ctx, filter, opts...)
+	if err != nil {
+		return mongo.ListDatabasesResult{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := mongo.ListDatabasesResult{}
+	for _, name := range names {
+		empty := true
+		for _, c := range s.databases[name] {
+			if len(c.docs) > 0 {
+				empty = false
+				break
+			}
+		}
+		result.Databases = append(result.Databases, mongo.DatabaseSpecification{Name: name, Empty: empty})
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) ListDatabaseNames(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) ([]string, error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := []string{}
+	for name := range s.databases {
+		ok, err := matchDocument(bson.M{"name": name}, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemoryStore) UseSessionWithOptions(ctx context.Context, opts *options.SessionOptions, fn func(mongo.SessionContext) error) error {
+	session, err := s.StartSession(opts)
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	return fn(mongo.NewSessionContext(ctx, session))
+}
+
+func (s *MemoryStore) UseSession(ctx context.Context, fn func(mongo.SessionContext) error) error {
+	return s.UseSessionWithOptions(ctx, nil, fn)
+}
+
+func (s *MemoryStore) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, ErrChangeStreamNotSupported
+}
+
+func (s *MemoryStore) NumberSessionsInProgress() int {
+	return int(atomic.LoadInt64(&s.sessions))
+}
+
+func (s *MemoryStore) Timeout() *time.Duration {
+	return nil
+}
+
+func (s *MemoryStore) Close(ctx context.Context) {}
+
+func (s *MemoryStore) Disconnect(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Database(name string) Database {
+	return &memoryDatabase{store: s, name: name}
+}
+
+func (s *MemoryStore) StartSession(opts ...*options.SessionOptions) (mongo.Session, error) {
+	atomic.AddInt64(&s.sessions, 1)
+	return &memorySession{store: s}, nil
+}
+
+// EnsureUniqueIndex declares a unique index over keys on the given
+// collection. Later writes that would duplicate the key fail with an E11000
+// write exception, so mongo.IsDuplicateKeyError behaves as it does against a
+// real server.
+func (s *MemoryStore) EnsureUniqueIndex(database, collection string, keys ...string) error {
+	if len(keys) == 0 {
+		return errors.New("store: unique index requires at least one key")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.collection(database, collection)
+	index := memoryIndex{name: indexName(keys), keys: keys}
+	seen := map[string]bool{}
+	for _, doc := range c.docs {
+		key, ok := index.key(doc)
+		if !ok {
+			continue
+		}
+		if seen[key] {
+			return duplicateKeyError(c, index, 0)
+		}
+		seen[key] = true
+	}
+	c.indexes = append(c.indexes, index)
+	return nil
+}
+
+// collection must be called with s.mu held.
+func (s *MemoryStore) collection(database, name string) *memoryCollection {
+	db, ok := s.databases[database]
+	if !ok {
+		db = map[string]*memoryCollection{}
+		s.databases[database] = db
+	}
+	c, ok := db[name]
+	if !ok {
+		c = &memoryCollection{store: s, database: database, name: name}
+		db[name] = c
+	}
+	return c
+}
+
+type memoryDatabase struct {
+	store *MemoryStore
+	name  string
+}
+
+func (d *memoryDatabase) Name() string {
+	return d.name
+}
+
+func (d *memoryDatabase) Collection(name string) Collection {
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	return d.store.collection(d.name, name)
+}
+
+type memoryIndex struct {
+	name string
+	keys []string
+}
+
+func (i memoryIndex) key(doc bson.M) (string, bool) {
+	parts := make([]string, 0, len(i.keys))
+	for _, k := range i.keys {
+		v, ok := lookup(doc, k)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, fmt.Sprintf("%T:%v", v, v))
+	}
+	return strings.Join(parts, "|"), true
+}
+
+func indexName(keys []string) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"_1")
+	}
+	return strings.Join(parts, "_")
+}
+
+func duplicateKeyError(c *memoryCollection, index memoryIndex, i int) error {
+	return mongo.WriteException{
+		WriteErrors: mongo.WriteErrors{{
+			Index:   i,
+			Code:    11000,
+			Message: fmt.Sprintf("E11000 duplicate key error collection: %s.%s index: %s", c.database, c.name, index.name),
+		}},
+	}
+}
+
+type memoryCollection struct {
+	store    *MemoryStore
+	database string
+	name     string
+	docs     []bson.M
+	indexes  []memoryIndex
+}
+
+func (c *memoryCollection) Name() string {
+	return c.name
+}
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	findOpts := options.Find().SetLimit(1)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Sort != nil {
+			findOpts.SetSort(o.Sort)
+		}
+		if o.Skip != nil {
+			findOpts.SetSkip(*o.Skip)
+		}
+	}
+
+	docs, err := c.find(ctx, filter, findOpts)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	if len(docs) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(docs[0], nil, nil)
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	docs, err := c.find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return mongo.NewCursorFromDocuments(docs, nil, nil)
+}
+
+func (c *memoryCollection) find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+
+	matched := []bson.M{}
+	for _, doc := range c.docs {
+		ok, err := matchDocument(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+
+	o := options.MergeFindOptions(opts...)
+	if o.Sort != nil {
+		if err := sortDocuments(matched, o.Sort); err != nil {
+			return nil, err
+		}
+	}
+	if o.Skip != nil && *o.Skip > 0 {
+		if int(*o.Skip) >= len(matched) {
+			matched = nil
+		} else {
+			matched = matched[*o.Skip:]
+		}
+	}
+	if o.Limit != nil && *o.Limit > 0 && int(*o.Limit) < len(matched) {
+		matched = matched[:*o.Limit]
+	}
+
+	result := make([]interface{}, 0, len(matched))
+	for _, doc := range matched {
+		result = append(result, copyDocument(doc))
+	}
+	return result, nil
+}
+
+func (c *memoryCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, err := toDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, mongo.ErrNilDocument
+	}
+
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	id, err := c.insert(doc, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.record(ctx, id, nil)
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+func (c *memoryCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, mongo.ErrEmptySlice
+	}
+
+	docs := make([]bson.M, 0, len(documents))
+	for _, d := range documents {
+		doc, err := toDocument(d)
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			return nil, mongo.ErrNilDocument
+		}
+		docs = append(docs, doc)
+	}
+
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	ordered := true
+	for _, o := range opts {
+		if o != nil && o.Ordered != nil {
+			ordered = *o.Ordered
+		}
+	}
+
+	result := &mongo.InsertManyResult{}
+	var failed []mongo.BulkWriteError
+	for i, doc := range docs {
+		id, err := c.insert(doc, i)
+		if err != nil {
+			var writeErr mongo.WriteException
+			if !errors.As(err, &writeErr) {
+				return result, err
+			}
+			for _, e := range writeErr.WriteErrors {
+				failed = append(failed, mongo.BulkWriteError{WriteError: e})
+			}
+			// like the server, an unordered insert carries on past a failed document
+			if ordered {
+				break
+			}
+			continue
+		}
+		c.record(ctx, id, nil)
+		result.InsertedIDs = append(result.InsertedIDs, id)
+	}
+	if len(failed) > 0 {
+		return result, mongo.BulkWriteException{WriteErrors: failed}
+	}
+	return result, nil
+}
+
+// insert must be called with the store lock held.
+func (c *memoryCollection) insert(doc bson.M, i int) (interface{}, error) {
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	if err := c.checkUnique(doc, -1, i); err != nil {
+		return nil, err
+	}
+	c.docs = append(c.docs, doc)
+	return doc["_id"], nil
+}
+
+// checkUnique reports whether doc would violate a unique index. skip is the
+// position of doc itself when it is already stored.
+func (c *memoryCollection) checkUnique(doc bson.M, skip, i int) error {
+	indexes := append([]memoryIndex{idIndex}, c.indexes...)
+	for _, index := range indexes {
+		key, ok := index.key(doc)
+		if !ok {
+			continue
+		}
+		for n, other := range c.docs {
+			if n == skip {
+				continue
+			}
+			if otherKey, ok := index.key(other); ok && otherKey == key {
+				return duplicateKeyError(c, index, i)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *memoryCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(ctx, filter, update, false, opts...)
+}
+
+func (c *memoryCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(ctx, filter, update, true, opts...)
+}
+
+func (c *memoryCollection) update(ctx context.Context, filter interface{}, update interface{}, many bool, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	u, err := toDocument(update)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUpdate(u); err != nil {
+		return nil, err
+	}
+	o := options.MergeUpdateOptions(opts...)
+
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	result := &mongo.UpdateResult{}
+	for i, doc := range c.docs {
+		ok, err := matchDocument(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		result.MatchedCount++
+		updated := copyDocument(doc)
+		if err := applyUpdate(updated, u, false); err != nil {
+			return nil, err
+		}
+		if err := c.checkUnique(updated, i, 0); err != nil {
+			return nil, err
+		}
+		if !equalValues(doc, updated) {
+			c.record(ctx, doc["_id"], doc)
+			c.docs[i] = updated
+			result.ModifiedCount++
+		}
+		if !many {
+			break
+		}
+	}
+
+	if result.MatchedCount == 0 && o.Upsert != nil && *o.Upsert {
+		doc := upsertSeed(f)
+		if err := applyUpdate(doc, u, true); err != nil {
+			return nil, err
+		}
+		id, err := c.insert(doc, 0)
+		if err != nil {
+			return nil, err
+		}
+		c.record(ctx, id, nil)
+		result.UpsertedCount = 1
+		result.UpsertedID = id
+	}
+
+	return result, nil
+}
+
+func (c *memoryCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, filter, false)
+}
+
+func (c *memoryCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, filter, true)
+}
+
+func (c *memoryCollection) delete(ctx context.Context, filter interface{}, many bool) (*mongo.DeleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	result := &mongo.DeleteResult{}
+	kept := c.docs[:0:0]
+	for _, doc := range c.docs {
+		if many || result.DeletedCount == 0 {
+			ok, err := matchDocument(doc, f)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				c.record(ctx, doc["_id"], doc)
+				result.DeletedCount++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	c.docs = kept
+	return result, nil
+}
+
+// memoryUndo restores one document written in a transaction: before is the
+// stored document before the write, nil if the write inserted it.
+type memoryUndo struct {
+	collection *memoryCollection
+	id         interface{}
+	before     bson.M
+}
+
+var idIndex = memoryIndex{name: "_id_", keys: []string{"_id"}}
+
+// record adds an undo entry to the transaction attached to ctx, if any. Only
+// the documents the transaction wrote are rolled back on abort, so writes
+// made outside it in the meantime survive. It must be called with the store
+// lock held.
+func (c *memoryCollection) record(ctx context.Context, id interface{}, before bson.M) {
+	session, ok := mongo.SessionFromContext(ctx).(*memorySession)
+	if !ok || session.store != c.store || !session.active {
+		return
+	}
+	session.undo = append(session.undo, memoryUndo{c, id, before})
+}
+
+// restore puts back the document stored under id before a write. It must be
+// called with the store lock held.
+func (c *memoryCollection) restore(id interface{}, before bson.M) {
+	key, _ := idIndex.key(bson.M{"_id": id})
+	n := -1
+	for i, doc := range c.docs {
+		if other, ok := idIndex.key(doc); ok && other == key {
+			n = i
+			break
+		}
+	}
+	switch {
+	case before == nil && n >= 0:
+		c.docs = append(c.docs[:n:n], c.docs[n+1:]...)
+	case before != nil && n >= 0:
+		c.docs[n] = before
+	case before != nil:
+		c.docs = append(c.docs, before)
+	}
+}
+
+var (
+	errNoTransaction     = errors.New("no transaction started")
+	errTransactionActive = errors.New("transaction already in progress")
+	errSessionEnded      = errors.New("ended session was used")
+)
+
+// memorySession implements mongo.Session. The embedded interface is never
+// set; it only satisfies the driver's unexported marker method.
+type memorySession struct {
+	mongo.Session
+
+	store *MemoryStore
+	// active is set while a transaction is open; undo holds its writes in
+	// the order they were made.
+	active bool
+	undo   []memoryUndo
+	ended  bool
+}
+
+func (s *memorySession) StartTransaction(opts ...*options.TransactionOptions) error {
+	if s.ended {
+		return errSessionEnded
+	}
+	if s.active {
+		return errTransactionActive
+	}
+	s.active = true
+	return nil
+}
+
+func (s *memorySession) AbortTransaction(ctx context.Context) error {
+	if !s.active {
+		return errNoTransaction
+	}
+
+	s.store.mu.Lock()
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		u := s.undo[i]
+		u.collection.restore(u.id, u.before)
+	}
+	s.store.mu.Unlock()
+
+	s.active, s.undo = false, nil
+	return nil
+}
+
+func (s *memorySession) CommitTransaction(ctx context.Context) error {
+	if !s.active {
+		return errNoTransaction
+	}
+	s.active, s.undo = false, nil
+	return nil
+}
+
+func (s *memorySession) WithTransaction(ctx context.Context, fn func(ctx mongo.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
+	if err := s.StartTransaction(opts...); err != nil {
+		return nil, err
+	}
+
+	result, err := fn(mongo.NewSessionContext(ctx, s))
+	if err != nil {
+		s.AbortTransaction(ctx)
+		return nil, err
+	}
+	if err := s.CommitTransaction(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *memorySession) EndSession(ctx context.Context) {
+	if s.ended {
+		return
+	}
+	if s.active {
+		s.AbortTransaction(ctx)
+	}
+	s.ended = true
+	atomic.AddInt64(&s.store.sessions, -1)
+}
+
+func (s *memorySession) ClusterTime() bson.Raw {
+	return nil
+}
+
+func (s *memorySession) OperationTime() *primitive.Timestamp {
+	return nil
+}
+
+func (s *memorySession) Client() *mongo.Client {
+	return nil
+}
+
+func (s *memorySession) ID() bson.Raw {
+	return nil
+}
+
+func (s *memorySession) AdvanceClusterTime(bson.Raw) error {
+	if s.ended {
+		return errSessionEnded
+	}
+	return nil
+}
+
+func (s *memorySession) AdvanceOperationTime(*primitive.Timestamp) error {
+	if s.ended {
+		return errSessionEnded
+	}
+	return nil
+}
@@ -0,0 +1,759 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// toDocument round-trips v through BSON so that structs, bson.D and bson.M
+// filters, updates and documents all end up in the same normalized shape.
+func toDocument(v interface{}) (bson.M, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return normalize(doc).(bson.M), nil
+}
+
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.M:
+		m := make(bson.M, len(t))
+		for k, val := range t {
+			m[k] = normalize(val)
+		}
+		return m
+	case bson.D:
+		m := make(bson.M, len(t))
+		for _, e := range t {
+			m[e.Key] = normalize(e.Value)
+		}
+		return m
+	case bson.A:
+		a := make(bson.A, len(t))
+		for i, val := range t {
+			a[i] = normalize(val)
+		}
+		return a
+	case []interface{}:
+		return normalize(bson.A(t))
+	default:
+		return v
+	}
+}
+
+func copyDocument(doc bson.M) bson.M {
+	return copyValue(doc).(bson.M)
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.M:
+		m := make(bson.M, len(t))
+		for k, val := range t {
+			m[k] = copyValue(val)
+		}
+		return m
+	case bson.A:
+		a := make(bson.A, len(t))
+		for i, val := range t {
+			a[i] = copyValue(val)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		switch t := current.(type) {
+		case bson.M:
+			v, ok := t[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case bson.A:
+			i, err := strconv.Atoi(part)
+			if err == nil {
+				if i < 0 || i >= len(t) {
+					return nil, false
+				}
+				current = t[i]
+				continue
+			}
+			values := bson.A{}
+			for _, e := range t {
+				if m, ok := e.(bson.M); ok {
+					if v, ok := m[part]; ok {
+						values = append(values, v)
+					}
+				}
+			}
+			if len(values) == 0 {
+				return nil, false
+			}
+			current = values
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func matchDocument(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		var (
+			ok  bool
+			err error
+		)
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, key, cond)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("store: unsupported top-level operator %s", key)
+			}
+			value, exists := lookup(doc, key)
+			ok, err = matchCondition(value, exists, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, cond interface{}) (bool, error) {
+	clauses, ok := cond.(bson.A)
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("store: %s must be a nonempty array", op)
+	}
+	for _, c := range clauses {
+		sub, ok := c.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("store: %s entries must be documents", op)
+		}
+		matched, err := matchDocument(doc, sub)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+func isOperatorDocument(v interface{}) (bson.M, bool) {
+	m, ok := v.(bson.M)
+	if !ok || len(m) == 0 {
+		return nil, false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+	return m, true
+}
+
+func matchCondition(value interface{}, exists bool, cond interface{}) (bool, error) {
+	ops, ok := isOperatorDocument(cond)
+	if !ok {
+		if re, ok := cond.(primitive.Regex); ok {
+			return matchRegex(value, re.Pattern, re.Options)
+		}
+		return matchEqual(value, exists, cond), nil
+	}
+
+	for op, target := range ops {
+		matched, err := matchOperator(value, exists, op, target, ops)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(value interface{}, exists bool, op string, target interface{}, ops bson.M) (bool, error) {
+	switch op {
+	case "$eq":
+		return matchEqual(value, exists, target), nil
+	case "$ne":
+		return !matchEqual(value, exists, target), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		if !exists {
+			return false, nil
+		}
+		return anyValue(value, func(v interface{}) bool {
+			c, ok := compareValues(v, target)
+			if !ok {
+				return false
+			}
+			switch op {
+			case "$gt":
+				return c > 0
+			case "$gte":
+				return c >= 0
+			case "$lt":
+				return c < 0
+			default:
+				return c <= 0
+			}
+		}), nil
+	case "$in", "$nin":
+		list, ok := target.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("store: %s needs an array", op)
+		}
+		found := false
+		for _, t := range list {
+			if matchEqual(value, exists, t) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in"), nil
+	case "$exists":
+		return truthy(target) == exists, nil
+	case "$regex":
+		pattern, flags := "", ""
+		switch t := target.(type) {
+		case string:
+			pattern = t
+		case primitive.Regex:
+			pattern, flags = t.Pattern, t.Options
+		default:
+			return false, errors.New("store: $regex has to be a string")
+		}
+		if o, ok := ops["$options"].(string); ok {
+			flags = o
+		}
+		return matchRegex(value, pattern, flags)
+	case "$options":
+		if _, ok := ops["$regex"]; !ok {
+			return false, errors.New("store: $options needs a $regex")
+		}
+		return true, nil
+	case "$not":
+		matched, err := matchCondition(value, exists, target)
+		return !matched, err
+	case "$size":
+		arr, ok := value.(bson.A)
+		if !ok {
+			return false, nil
+		}
+		n, ok := toFloat(target)
+		return ok && float64(len(arr)) == n, nil
+	case "$all":
+		list, ok := target.(bson.A)
+		if !ok {
+			return false, errors.New("store: $all needs an array")
+		}
+		for _, t := range list {
+			if !matchEqual(value, exists, t) {
+				return false, nil
+			}
+		}
+		return len(list) > 0, nil
+	case "$elemMatch":
+		arr, ok := value.(bson.A)
+		if !ok {
+			return false, nil
+		}
+		for _, e := range arr {
+			var matched bool
+			var err error
+			if doc, ok := e.(bson.M); ok {
+				if sub, ok := target.(bson.M); ok {
+					if _, isOps := isOperatorDocument(sub); !isOps {
+						matched, err = matchDocument(doc, sub)
+					} else {
+						matched, err = matchCondition(e, true, target)
+					}
+				}
+			} else {
+				matched, err = matchCondition(e, true, target)
+			}
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("store: unsupported operator %s", op)
+	}
+}
+
+func matchEqual(value interface{}, exists bool, target interface{}) bool {
+	if target == nil {
+		return !exists || value == nil
+	}
+	if !exists {
+		return false
+	}
+	if equalValues(value, target) {
+		return true
+	}
+	if arr, ok := value.(bson.A); ok {
+		for _, e := range arr {
+			if equalValues(e, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchRegex(value interface{}, pattern, flags string) (bool, error) {
+	prefix := ""
+	for _, f := range flags {
+		switch f {
+		case 'i', 'm', 's':
+			prefix += string(f)
+		}
+	}
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return anyValue(value, func(v interface{}) bool {
+		s, ok := v.(string)
+		return ok && re.MatchString(s)
+	}), nil
+}
+
+func anyValue(value interface{}, fn func(interface{}) bool) bool {
+	if arr, ok := value.(bson.A); ok {
+		for _, e := range arr {
+			if fn(e) {
+				return true
+			}
+		}
+		return false
+	}
+	return fn(value)
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case nil:
+		return false
+	default:
+		if f, ok := toFloat(v); ok {
+			return f != 0
+		}
+		return true
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	default:
+		return 0, false
+	}
+}
+
+func equalValues(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	switch ta := a.(type) {
+	case bson.M:
+		tb, ok := b.(bson.M)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for k, v := range ta {
+			w, ok := tb[k]
+			if !ok || !equalValues(v, w) {
+				return false
+			}
+		}
+		return true
+	case bson.A:
+		tb, ok := b.(bson.A)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for i := range ta {
+			if !equalValues(ta[i], tb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues orders two values of the same BSON type. The boolean is
+// false when the values are not comparable.
+func compareValues(a, b interface{}) (int, bool) {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(fa, fb), true
+	}
+	switch ta := a.(type) {
+	case string:
+		tb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(ta, tb), true
+	case primitive.DateTime:
+		tb, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(ta, tb), true
+	case primitive.ObjectID:
+		tb, ok := b.(primitive.ObjectID)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(ta[:], tb[:]), true
+	case primitive.Timestamp:
+		tb, ok := b.(primitive.Timestamp)
+		if !ok {
+			return 0, false
+		}
+		return primitive.CompareTimestamp(ta, tb), true
+	case bool:
+		tb, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case ta == tb:
+			return 0, true
+		case tb:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64 | primitive.DateTime](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// typeRank follows the server's cross-type sort order for the types the
+// memory store can hold.
+func typeRank(v interface{}) int {
+	if _, ok := toFloat(v); ok {
+		return 2
+	}
+	switch v.(type) {
+	case nil:
+		return 1
+	case string:
+		return 3
+	case bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	default:
+		return 11
+	}
+}
+
+func sortDocuments(docs []bson.M, spec interface{}) error {
+	raw, err := bson.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	var keys bson.D
+	if err := bson.Unmarshal(raw, &keys); err != nil {
+		return err
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, k := range keys {
+			direction, _ := toFloat(k.Value)
+			a, _ := lookup(docs[i], k.Key)
+			b, _ := lookup(docs[j], k.Key)
+			c := compareOrdered(int64(typeRank(a)), int64(typeRank(b)))
+			if c == 0 {
+				c, _ = compareValues(a, b)
+			}
+			if c != 0 {
+				if direction < 0 {
+					return c > 0
+				}
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+func validateUpdate(update bson.M) error {
+	if update == nil {
+		return mongo.ErrNilDocument
+	}
+	if len(update) == 0 {
+		return errors.New("update document must have at least one element")
+	}
+	for k := range update {
+		if !strings.HasPrefix(k, "$") {
+			return errors.New("update document must contain key beginning with '$'")
+		}
+	}
+	return nil
+}
+
+func applyUpdate(doc bson.M, update bson.M, inserting bool) error {
+	for op, v := range update {
+		fields, ok := v.(bson.M)
+		if !ok {
+			return fmt.Errorf("store: modifier %s expects a document", op)
+		}
+		for path, value := range fields {
+			if err := applyModifier(doc, op, path, value, inserting); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyModifier(doc bson.M, op, path string, value interface{}, inserting bool) error {
+	switch op {
+	case "$set":
+		return setPath(doc, path, copyValue(value))
+	case "$setOnInsert":
+		if inserting {
+			return setPath(doc, path, copyValue(value))
+		}
+		return nil
+	case "$unset":
+		unsetPath(doc, path)
+		return nil
+	case "$currentDate":
+		return setPath(doc, path, primitive.NewDateTimeFromTime(time.Now()))
+	case "$inc":
+		current, exists := lookup(doc, path)
+		if !exists {
+			current = int32(0)
+		}
+		sum, err := addNumbers(current, value)
+		if err != nil {
+			return fmt.Errorf("store: cannot $inc %s: %w", path, err)
+		}
+		return setPath(doc, path, sum)
+	case "$push", "$addToSet":
+		current, exists := lookup(doc, path)
+		arr, ok := current.(bson.A)
+		if exists && !ok {
+			return fmt.Errorf("store: %s target %s is not an array", op, path)
+		}
+		items := bson.A{value}
+		if m, ok := value.(bson.M); ok {
+			if each, ok := m["$each"].(bson.A); ok {
+				items = each
+			}
+		}
+		arr = append(bson.A{}, arr...)
+		for _, item := range items {
+			if op == "$addToSet" && matchEqual(arr, true, item) {
+				continue
+			}
+			arr = append(arr, copyValue(item))
+		}
+		return setPath(doc, path, arr)
+	case "$pull":
+		current, exists := lookup(doc, path)
+		if !exists {
+			return nil
+		}
+		arr, ok := current.(bson.A)
+		if !ok {
+			return fmt.Errorf("store: $pull target %s is not an array", path)
+		}
+		kept := bson.A{}
+		for _, e := range arr {
+			matched, err := matchCondition(e, true, value)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				kept = append(kept, e)
+			}
+		}
+		return setPath(doc, path, kept)
+	default:
+		return fmt.Errorf("store: unknown modifier %s", op)
+	}
+}
+
+func addNumbers(a, b interface{}) (interface{}, error) {
+	fa, ok := toFloat(a)
+	if !ok {
+		return nil, fmt.Errorf("non-numeric field of type %T", a)
+	}
+	fb, ok := toFloat(b)
+	if !ok {
+		return nil, fmt.Errorf("non-numeric increment of type %T", b)
+	}
+	_, af := a.(float64)
+	_, bf := b.(float64)
+	if af || bf {
+		return fa + fb, nil
+	}
+	sum := int64(fa) + int64(fb)
+	_, a32 := a.(int32)
+	_, b32 := b.(int32)
+	if a32 && b32 && sum >= math.MinInt32 && sum <= math.MaxInt32 {
+		return int32(sum), nil
+	}
+	return sum, nil
+}
+
+func setPath(doc bson.M, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	var current interface{} = doc
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch t := current.(type) {
+		case bson.M:
+			if last {
+				t[part] = value
+				return nil
+			}
+			next, ok := t[part]
+			if !ok || next == nil {
+				next = bson.M{}
+				t[part] = next
+			}
+			current = next
+		case bson.A:
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 || n >= len(t) {
+				return fmt.Errorf("store: cannot set %s", path)
+			}
+			if last {
+				t[n] = value
+				return nil
+			}
+			current = t[n]
+		default:
+			return fmt.Errorf("store: cannot create field %s in %T", part, current)
+		}
+	}
+	return nil
+}
+
+func unsetPath(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	parent, ok := doc, true
+	if len(parts) > 1 {
+		var v interface{}
+		v, ok = lookup(doc, strings.Join(parts[:len(parts)-1], "."))
+		parent, ok = v.(bson.M)
+	}
+	if ok {
+		delete(parent, parts[len(parts)-1])
+	}
+}
+
+// upsertSeed builds the base document of an upsert from the equality
+// clauses of filter, the same way the server does.
+func upsertSeed(filter bson.M) bson.M {
+	doc := bson.M{}
+	var collect func(bson.M)
+	collect = func(f bson.M) {
+		for k, v := range f {
+			if k == "$and" {
+				if clauses, ok := v.(bson.A); ok {
+					for _, c := range clauses {
+						if m, ok := c.(bson.M); ok {
+							collect(m)
+						}
+					}
+				}
+				continue
+			}
+			if strings.HasPrefix(k, "$") {
+				continue
+			}
+			if ops, ok := isOperatorDocument(v); ok {
+				if eq, ok := ops["$eq"]; ok {
+					setPath(doc, k, copyValue(eq))
+				}
+				continue
+			}
+			setPath(doc, k, copyValue(v))
+		}
+	}
+	collect(filter)
+	return doc
+}
@@ -0,0 +1,224 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sing3demons/auth-service/store"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type memoryUser struct {
+	ID    string   `bson:"id"`
+	Email string   `bson:"email"`
+	Age   int      `bson:"age"`
+	Roles []string `bson:"roles"`
+}
+
+func seedUsers(t *testing.T, col store.Collection) {
+	_, err := col.InsertMany(context.TODO(), []interface{}{
+		memoryUser{ID: "1", Email: "a@test.com", Age: 20, Roles: []string{"user"}},
+		memoryUser{ID: "2", Email: "b@test.com", Age: 30, Roles: []string{"user", "admin"}},
+		memoryUser{ID: "3", Email: "c@test.com", Age: 40, Roles: []string{"user"}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestMemoryStoreFind(t *testing.T) {
+	ctx := context.TODO()
+	col := store.NewMemoryStore().Database("auth").Collection("users")
+	seedUsers(t, col)
+
+	t.Run("FindOne by equality", func(t *testing.T) {
+		var u memoryUser
+		assert.NoError(t, col.FindOne(ctx, bson.M{"email": "b@test.com"}).Decode(&u))
+		assert.Equal(t, "2", u.ID)
+	})
+
+	t.Run("FindOne not found", func(t *testing.T) {
+		err := col.FindOne(ctx, bson.M{"email": "x@test.com"}).Decode(&memoryUser{})
+		assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	})
+
+	t.Run("Find with operators and sort", func(t *testing.T) {
+		filter := bson.M{
+			"age":   bson.M{"$gte": 25},
+			"$or":   bson.A{bson.M{"roles": "admin"}, bson.M{"email": bson.M{"$regex": "^C@", "$options": "i"}}},
+			"email": bson.M{"$nin": bson.A{"a@test.com"}},
+		}
+		cur, err := col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "age", Value: -1}}))
+		assert.NoError(t, err)
+
+		var users []memoryUser
+		assert.NoError(t, cur.All(ctx, &users))
+		assert.Len(t, users, 2)
+		assert.Equal(t, "3", users[0].ID)
+		assert.Equal(t, "2", users[1].ID)
+	})
+
+	t.Run("Find with skip and limit", func(t *testing.T) {
+		cur, err := col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"age": 1}).SetSkip(1).SetLimit(1))
+		assert.NoError(t, err)
+
+		var users []memoryUser
+		assert.NoError(t, cur.All(ctx, &users))
+		assert.Len(t, users, 1)
+		assert.Equal(t, "2", users[0].ID)
+	})
+}
+
+func TestMemoryStoreUpdate(t *testing.T) {
+	ctx := context.TODO()
+	col := store.NewMemoryStore().Database("auth").Collection("users")
+	seedUsers(t, col)
+
+	t.Run("UpdateOne with operators", func(t *testing.T) {
+		result, err := col.UpdateOne(ctx, bson.M{"id": "1"}, bson.M{"$set": bson.M{"email": "new@test.com"}, "$inc": bson.M{"age": 1}, "$addToSet": bson.M{"roles": "admin"}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.ModifiedCount)
+
+		var u memoryUser
+		assert.NoError(t, col.FindOne(ctx, bson.M{"id": "1"}).Decode(&u))
+		assert.Equal(t, "new@test.com", u.Email)
+		assert.Equal(t, 21, u.Age)
+		assert.Equal(t, []string{"user", "admin"}, u.Roles)
+	})
+
+	t.Run("UpdateOne rejects replacement documents", func(t *testing.T) {
+		_, err := col.UpdateOne(ctx, bson.M{"id": "1"}, memoryUser{ID: "1"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Upsert inserts from filter", func(t *testing.T) {
+		result, err := col.UpdateOne(ctx, bson.M{"id": "4"}, bson.M{"$set": bson.M{"email": "d@test.com"}}, options.Update().SetUpsert(true))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.UpsertedCount)
+		assert.NotNil(t, result.UpsertedID)
+
+		var u memoryUser
+		assert.NoError(t, col.FindOne(ctx, bson.M{"email": "d@test.com"}).Decode(&u))
+		assert.Equal(t, "4", u.ID)
+	})
+
+	t.Run("DeleteMany", func(t *testing.T) {
+		result, err := col.DeleteMany(ctx, bson.M{"age": bson.M{"$lt": 35}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), result.DeletedCount)
+	})
+}
+
+func TestMemoryStoreUniqueIndex(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	assert.NoError(t, db.EnsureUniqueIndex("auth", "users", "email"))
+
+	col := db.Database("auth").Collection("users")
+	_, err := col.InsertOne(ctx, memoryUser{ID: "1", Email: "a@test.com"})
+	assert.NoError(t, err)
+
+	_, err = col.InsertOne(ctx, memoryUser{ID: "2", Email: "a@test.com"})
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+
+	_, err = col.InsertOne(ctx, memoryUser{ID: "2", Email: "b@test.com"})
+	assert.NoError(t, err)
+
+	_, err = col.UpdateOne(ctx, bson.M{"id": "2"}, bson.M{"$set": bson.M{"email": "a@test.com"}})
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+
+	// an unordered insert stores what it can and reports the rest
+	result, err := col.InsertMany(ctx, []interface{}{
+		memoryUser{ID: "3", Email: "a@test.com"},
+		memoryUser{ID: "4", Email: "d@test.com"},
+	}, options.InsertMany().SetOrdered(false))
+	assert.True(t, store.OnlyDuplicateKeys(err))
+	assert.Len(t, result.InsertedIDs, 1)
+	assert.NoError(t, col.FindOne(ctx, bson.M{"id": "4"}).Decode(&memoryUser{}))
+	assert.False(t, store.OnlyDuplicateKeys(errors.New("timeout")))
+}
+
+func TestMemoryStoreTransaction(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	col := db.Database("auth").Collection("users")
+	seedUsers(t, col)
+
+	t.Run("abort rolls back writes", func(t *testing.T) {
+		session, err := db.StartSession()
+		assert.NoError(t, err)
+		defer session.EndSession(ctx)
+
+		assert.NoError(t, session.StartTransaction())
+		sctx := mongo.NewSessionContext(ctx, session)
+		_, err = col.DeleteOne(sctx, bson.M{"id": "1"})
+		assert.NoError(t, err)
+		_, err = col.InsertOne(sctx, memoryUser{ID: "9"})
+		assert.NoError(t, err)
+		assert.NoError(t, session.AbortTransaction(ctx))
+
+		assert.NoError(t, col.FindOne(ctx, bson.M{"id": "1"}).Decode(&memoryUser{}))
+		assert.ErrorIs(t, col.FindOne(ctx, bson.M{"id": "9"}).Decode(&memoryUser{}), mongo.ErrNoDocuments)
+	})
+
+	t.Run("abort keeps writes made outside the transaction", func(t *testing.T) {
+		session, err := db.StartSession()
+		assert.NoError(t, err)
+		defer session.EndSession(ctx)
+
+		assert.NoError(t, session.StartTransaction())
+		sctx := mongo.NewSessionContext(ctx, session)
+		_, err = col.UpdateOne(sctx, bson.M{"id": "2"}, bson.M{"$set": bson.M{"age": 99}})
+		assert.NoError(t, err)
+		_, err = col.UpdateOne(sctx, bson.M{"id": "2"}, bson.M{"$inc": bson.M{"age": 1}})
+		assert.NoError(t, err)
+		_, err = col.InsertOne(ctx, memoryUser{ID: "7"})
+		assert.NoError(t, err)
+		_, err = col.UpdateOne(ctx, bson.M{"id": "3"}, bson.M{"$set": bson.M{"age": 41}})
+		assert.NoError(t, err)
+		assert.NoError(t, session.AbortTransaction(ctx))
+
+		var u memoryUser
+		assert.NoError(t, col.FindOne(ctx, bson.M{"id": "2"}).Decode(&u))
+		assert.Equal(t, 30, u.Age)
+		assert.NoError(t, col.FindOne(ctx, bson.M{"id": "3"}).Decode(&u))
+		assert.Equal(t, 41, u.Age)
+		assert.NoError(t, col.FindOne(ctx, bson.M{"id": "7"}).Decode(&u))
+	})
+
+	t.Run("WithTransaction commits", func(t *testing.T) {
+		err := db.UseSession(ctx, func(sctx mongo.SessionContext) error {
+			_, err := sctx.WithTransaction(sctx, func(sctx mongo.SessionContext) (interface{}, error) {
+				return col.InsertOne(sctx, memoryUser{ID: "5"})
+			})
+			return err
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, col.FindOne(ctx, bson.M{"id": "5"}).Decode(&memoryUser{}))
+		assert.Equal(t, 0, db.NumberSessionsInProgress())
+	})
+
+	t.Run("AfterCommit waits for the commit", func(t *testing.T) {
+		var ran []string
+		err := store.WithTransaction(ctx, db, func(ctx context.Context) error {
+			store.AfterCommit(ctx, func() { ran = append(ran, "committed") })
+			assert.Empty(t, ran)
+			_, err := col.InsertOne(ctx, memoryUser{ID: "6"})
+			return err
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"committed"}, ran)
+
+		err = store.WithTransaction(ctx, db, func(ctx context.Context) error {
+			store.AfterCommit(ctx, func() { ran = append(ran, "aborted") })
+			return errors.New("rollback")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, []string{"committed"}, ran, "rolled back transactions skip their hooks")
+
+		store.AfterCommit(ctx, func() { ran = append(ran, "direct") })
+		assert.Equal(t, []string{"committed", "direct"}, ran)
+	})
+}
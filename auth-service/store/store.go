@@ -2,8 +2,8 @@ package store
 
 import (
 	"context"
+	"errors"
 	"log"
-	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,9 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func NewStore(ctx context.Context) *mongo.Client {
-	url := os.Getenv("MONGO_URI")
-
+func NewStore(ctx context.Context, url string) *mongo.Client {
 	loggerOptions := options.Logger().SetComponentLevel(options.LogComponentCommand, options.LogLevelDebug)
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url).SetLoggerOptions(loggerOptions))
 	if err != nil {
@@ -102,6 +100,75 @@ func (s *store) StartSession(opts ...*options.SessionOptions) (mongo.Session, er
 	return s.Client.StartSession(opts...)
 }
 
+// WithTransaction runs fn in a transaction on s and commits it when fn
+// succeeds. When ctx already carries a session, fn joins that session's
+// transaction instead, so several writes can share one commit.
+func WithTransaction(ctx context.Context, s Store, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	var hooks []func()
+	err := s.UseSession(ctx, func(sc mongo.SessionContext) error {
+		if err := sc.StartTransaction(); err != nil {
+			return err
+		}
+		if err := fn(context.WithValue(sc, afterCommitKey{}, &hooks)); err != nil {
+			sc.AbortTransaction(sc)
+			return err
+		}
+		return sc.CommitTransaction(sc)
+	})
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+// OnlyDuplicateKeys reports whether every write in err failed on a
+// duplicate key, as when an unordered InsertMany retries documents that are
+// already stored.
+func OnlyDuplicateKeys(err error) bool {
+	var writeErrors []mongo.WriteError
+	var bulk mongo.BulkWriteException
+	var write mongo.WriteException
+	switch {
+	case errors.As(err, &bulk):
+		if bulk.WriteConcernError != nil {
+			return false
+		}
+		for _, e := range bulk.WriteErrors {
+			writeErrors = append(writeErrors, e.WriteError)
+		}
+	case errors.As(err, &write):
+		if write.WriteConcernError != nil {
+			return false
+		}
+		writeErrors = write.WriteErrors
+	}
+	for _, e := range writeErrors {
+		if e.Code != 11000 {
+			return false
+		}
+	}
+	return len(writeErrors) > 0
+}
+
+type afterCommitKey struct{}
+
+// AfterCommit runs fn once the transaction ctx belongs to has committed,
+// and not at all when it rolls back. Outside a WithTransaction it runs fn
+// straight away.
+func AfterCommit(ctx context.Context, fn func()) {
+	if hooks, ok := ctx.Value(afterCommitKey{}).(*[]func()); ok {
+		*hooks = append(*hooks, fn)
+		return
+	}
+	fn()
+}
+
 type Database interface {
 	Name() string
 	Collection(name string) Collection
@@ -131,6 +198,25 @@ type Collection interface {
 	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
 }
 
+// Indexer is implemented by collections that can create indexes.
+type Indexer interface {
+	CreateIndexes(ctx context.Context, models ...mongo.IndexModel) error
+}
+
+// EnsureIndexes creates models on c when it is backed by a server. Creating
+// an index that already exists is a no-op, so it is safe on every start.
+// The memory store scans its documents and needs none.
+func EnsureIndexes(ctx context.Context, c Collection, models ...mongo.IndexModel) error {
+	switch c := c.(type) {
+	case Indexer:
+		return c.CreateIndexes(ctx, models...)
+	case *mongo.Collection:
+		_, err := c.Indexes().CreateMany(ctx, models)
+		return err
+	}
+	return nil
+}
+
 func NewCollection(collection Collection) Collection {
 	return &mongoCollection{collection: collection}
 }
@@ -143,6 +229,10 @@ func (c *mongoCollection) Name() string {
 	return c.collection.Name()
 }
 
+func (c *mongoCollection) CreateIndexes(ctx context.Context, models ...mongo.IndexModel) error {
+	return EnsureIndexes(ctx, c.collection, models...)
+}
+
 type SingleResult interface {
 	Decode(v interface{}) error
 }
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sing3demons/auth-service/metrics"
+	"github.com/sing3demons/auth-service/tracing"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type instrumentedStore struct {
+	Store
+}
+
+// NewInstrumented traces every collection operation made through next and
+// records its latency and result. A FindOne without a match counts as a
+// success.
+func NewInstrumented(next Store) Store {
+	return &instrumentedStore{next}
+}
+
+func (s *instrumentedStore) Database(name string) Database {
+	return &instrumentedDatabase{s.Store.Database(name)}
+}
+
+type instrumentedDatabase struct {
+	Database
+}
+
+func (d *instrumentedDatabase) Collection(name string) Collection {
+	return &instrumentedCollection{d.Database.Collection(name), d.Name(), tracing.Tracer("store")}
+}
+
+type instrumentedCollection struct {
+	Collection
+	database string
+	tracer   trace.Tracer
+}
+
+func (c *instrumentedCollection) start(ctx context.Context, operation string) (context.Context, func(error)) {
+	begin := time.Now()
+	ctx, span := c.tracer.Start(ctx, "mongo "+c.Name()+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBName(c.database),
+			semconv.DBMongoDBCollection(c.Name()),
+			semconv.DBOperation(operation),
+		))
+	return ctx, func(err error) {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = nil
+		}
+		metrics.ObserveMongo(c.Name(), operation, begin, err)
+		tracing.End(span, err)
+	}
+}
+
+func (c *instrumentedCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	ctx, end := c.start(ctx, "find_one")
+	result := c.Collection.FindOne(ctx, filter, opts...)
+	end(result.Err())
+	return result
+}
+
+func (c *instrumentedCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	ctx, end := c.start(ctx, "find")
+	cursor, err := c.Collection.Find(ctx, filter, opts...)
+	end(err)
+	return cursor, err
+}
+
+func (c *instrumentedCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	ctx, end := c.start(ctx, "insert_one")
+	result, err := c.Collection.InsertOne(ctx, document, opts...)
+	end(err)
+	return result, err
+}
+
+func (c *instrumentedCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	ctx, end := c.start(ctx, "insert_many")
+	result, err := c.Collection.InsertMany(ctx, documents, opts...)
+	end(err)
+	return result, err
+}
+
+func (c *instrumentedCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	ctx, end := c.start(ctx, "update_one")
+	result, err := c.Collection.UpdateOne(ctx, filter, update, opts...)
+	end(err)
+	return result, err
+}
+
+func (c *instrumentedCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	ctx, end := c.start(ctx, "update_many")
+	result, err := c.Collection.UpdateMany(ctx, filter, update, opts...)
+	end(err)
+	return result, err
+}
+
+func (c *instrumentedCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	ctx, end := c.start(ctx, "delete_one")
+	result, err := c.Collection.DeleteOne(ctx, filter, opts...)
+	end(err)
+	return result, err
+}
+
+func (c *instrumentedCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	ctx, end := c.start(ctx, "delete_many")
+	result, err := c.Collection.DeleteMany(ctx, filter, opts...)
+	end(err)
+	return result, err
+}
+
+func (c *instrumentedCollection) CreateIndexes(ctx context.Context, models ...mongo.IndexModel) error {
+	ctx, end := c.start(ctx, "create_indexes")
+	err := EnsureIndexes(ctx, c.Collection, models...)
+	end(err)
+	return err
+}
@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sing3demons/auth-service/store"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func mongoSamples(t *testing.T, operation, result string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "auth_mongo_operation_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["collection"] == "users" && labels["operation"] == operation && labels["result"] == result {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestInstrumented(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewInstrumented(store.NewMemoryStore()).Database("auth").Collection("users")
+
+	insert, find := mongoSamples(t, "insert_one", "success"), mongoSamples(t, "find_one", "success")
+
+	_, err := users.InsertOne(ctx, memoryUser{ID: "1", Email: "a@example.com"})
+	assert.NoError(t, err)
+	var found memoryUser
+	assert.NoError(t, users.FindOne(ctx, bson.M{"id": "1"}).Decode(&found))
+	assert.Error(t, users.FindOne(ctx, bson.M{"id": "2"}).Err())
+
+	assert.Equal(t, insert+1, mongoSamples(t, "insert_one", "success"))
+	assert.Equal(t, find+2, mongoSamples(t, "find_one", "success"), "no match is not a failure")
+}
@@ -0,0 +1,87 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/redis"
+	"github.com/sing3demons/auth-service/router"
+	"github.com/sing3demons/auth-service/store"
+	"github.com/sing3demons/auth-service/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanID = "00f067aa0ba902b7"
+)
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(exporter, tracing.Config{})
+	otel.SetTracerProvider(provider)
+	_, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	assert.NoError(t, err)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	cache := redis.NewInstrumented(redis.NewMemory())
+	defer cache.Close()
+	users := store.NewInstrumented(store.NewMemoryStore()).Database("auth").Collection("users")
+
+	r := router.New()
+	r.Use(tracing.Middleware(), mlog.Middleware(logger))
+	r.GET("/users/:id", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		mlog.L(ctx).Info("get user")
+		cache.Get(ctx, "user:id:"+c.Param("id"))
+		users.FindOne(ctx, bson.M{"id": c.Param("id")})
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	r.(http.Handler).ServeHTTP(httptest.NewRecorder(), req)
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 3)
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		assert.Equal(t, traceID, span.SpanContext.TraceID().String())
+		byName[span.Name] = span
+	}
+
+	server, ok := byName["GET /users/:id"]
+	assert.True(t, ok)
+	assert.Equal(t, parentSpanID, server.Parent.SpanID().String())
+	assert.True(t, server.Parent.IsRemote())
+	assert.Equal(t, server.SpanContext.SpanID(), byName["redis get"].Parent.SpanID())
+	assert.Equal(t, server.SpanContext.SpanID(), byName["mongo users.find_one"].Parent.SpanID())
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, traceID, line["trace_id"])
+	assert.Equal(t, server.SpanContext.SpanID().String(), line["span_id"])
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterStdout})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(context.Background(), tracing.Config{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sing3demons/auth-service/changestream"
+	"github.com/sing3demons/auth-service/events"
+)
+
+// HandleChange drops the cached copy of a user changed in the users
+// collection, which covers writes made by other replicas. Deletes only
+// carry the user ID when the change stream has pre-images; otherwise the
+// entry expires with its TTL.
+func (r *CachedUserRepository) HandleChange(ctx context.Context, change changestream.Change) error {
+	id := change.Lookup("id")
+	if id == "" {
+		return nil
+	}
+	return r.Invalidate(ctx, id)
+}
+
+// changeEventSpace derives event IDs from change stream resume tokens.
+var changeEventSpace = uuid.MustParse("3f0f5c1e-6d2a-4c55-9a43-1b7f2c9e8d10")
+
+// PublishDeletes publishes user.deleted for users removed from the users
+// collection. The service has no delete flow of its own, so these come from
+// outside it. Every replica sees the same change, so the event ID is
+// derived from the change: publisher should store events idempotently by
+// ID, as the outbox does, so the delete goes out once.
+func PublishDeletes(publisher events.Publisher) changestream.Handler {
+	return changestream.HandlerFunc(func(ctx context.Context, change changestream.Change) error {
+		if change.Operation != changestream.Delete {
+			return nil
+		}
+		id := change.Lookup("id")
+		if id == "" {
+			return nil
+		}
+		deletedAt := time.Unix(int64(change.ClusterTime.T), 0).UTC()
+		event := events.New(events.UserDeleted, id, events.Deleted{ID: id, DeletedAt: deletedAt})
+		event.ID = uuid.NewSHA1(changeEventSpace, change.ID).String()
+		event.Time = deletedAt
+		return publisher.Publish(ctx, event)
+	})
+}
@@ -0,0 +1,39 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/changestream"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/user"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPublishDeletes(t *testing.T) {
+	ctx := context.TODO()
+	publisher := events.NewMemory()
+	handler := user.PublishDeletes(publisher)
+
+	token, _ := bson.Marshal(bson.M{"_data": "8263"})
+	before, _ := bson.Marshal(bson.M{"id": subject})
+	deleted := changestream.Change{
+		ID:                       token,
+		Operation:                changestream.Delete,
+		ClusterTime:              primitive.Timestamp{T: 1700000000},
+		FullDocumentBeforeChange: before,
+	}
+	assert.NoError(t, handler.HandleChange(ctx, deleted))
+	assert.NoError(t, handler.HandleChange(ctx, deleted))
+	assert.NoError(t, handler.HandleChange(ctx, changestream.Change{ID: token, Operation: changestream.Delete}))
+	assert.NoError(t, handler.HandleChange(ctx, changestream.Change{ID: token, Operation: changestream.Update, FullDocument: before}))
+
+	published := publisher.Events()
+	assert.Len(t, published, 2)
+	assert.Equal(t, events.UserDeleted, published[0].Type)
+	assert.Equal(t, events.Deleted{ID: subject, DeletedAt: time.Unix(1700000000, 0).UTC()}, published[0].Data)
+	assert.Equal(t, published[0].ID, published[1].ID, "replicas publish the same change under one ID")
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +13,7 @@ import (
 type userHandler struct {
 	userService UserService
 	logger      *slog.Logger
+	hostURL     string
 }
 
 type UserHandler interface {
@@ -25,7 +25,12 @@ type UserHandler interface {
 }
 
 func NewUserHandler(userService UserService, logger *slog.Logger) UserHandler {
-	return &userHandler{userService, logger}
+	return NewUserHandlerWithHostURL(userService, logger, "")
+}
+
+// NewUserHandlerWithHostURL prefixes the links in responses with hostURL.
+func NewUserHandlerWithHostURL(userService UserService, logger *slog.Logger, hostURL string) UserHandler {
+	return &userHandler{userService, logger, hostURL}
 }
 
 func (u *userHandler) Refresh(c *gin.Context) {
@@ -99,7 +104,7 @@ func (u *userHandler) Profile(c *gin.Context) {
 }
 
 func (u *userHandler) HostUrl(url string) string {
-	return os.Getenv("HOST_URL") + url
+	return u.hostURL + url
 }
 
 func (u *userHandler) Register(c *gin.Context) {
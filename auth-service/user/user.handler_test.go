@@ -379,3 +379,37 @@ func TestVerifyToken(t *testing.T) {
 		mockUserService.AssertExpectations(t)
 	})
 }
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repository := user.NewMockUserRepository()
+	repository.On("FindByID", mock.Anything, "admin-1").Return(user.User{ID: "admin-1", Roles: []string{"user", "admin"}}, nil)
+	repository.On("FindByID", mock.Anything, "user-1").Return(user.User{ID: "user-1", Roles: []string{"user"}}, nil)
+	repository.On("FindByID", mock.Anything, "gone").Return(user.User{}, user.ErrUserNotFound)
+
+	tests := []struct {
+		subject string
+		code    int
+	}{
+		{"admin-1", http.StatusOK},
+		{"user-1", http.StatusForbidden},
+		{"gone", http.StatusForbidden},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		respRecorder := httptest.NewRecorder()
+		ctx, r := gin.CreateTestContext(respRecorder)
+		r.GET("/admin", func(c *gin.Context) {
+			if tt.subject != "" {
+				token := user.RegisteredClaims{}
+				token.Subject = tt.subject
+				c.Set("token", &token)
+			}
+		}, user.RequireRole(repository, "admin"), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		ctx.Request, _ = http.NewRequest(http.MethodGet, "/admin", nil)
+		r.HandleContext(ctx)
+		assert.Equal(t, tt.code, respRecorder.Code, tt.subject)
+	}
+}
@@ -80,6 +80,27 @@ type UpdateProfile struct {
 	UpdateDate     string `json:"updateDate,omitempty" bson:"updateDate,omitempty"`
 }
 
+// fields lists the JSON names of the profile fields the update sets, in
+// name order. UpdateUser ignores lastNameTH, descriptionTH and profileImageTH,
+// so they are never listed.
+func (p UpdateProfile) fields() []string {
+	fields := []string{}
+	for _, field := range []struct{ name, value string }{
+		{"address", p.Address},
+		{"description", p.Description},
+		{"firstName", p.FirstName},
+		{"firstNameTH", p.FirstNameTH},
+		{"lastName", p.LastName},
+		{"phone", p.Phone},
+		{"profileImage", p.ProfileImage},
+	} {
+		if field.value != "" {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
+
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token,omitempty"`
@@ -90,9 +111,13 @@ type RefreshTokenResponse struct {
 }
 
 type Login struct {
-	Username string `json:"username,omitempty"`
-	Email    string `json:"email,omitempty"`
-	Password string `json:"password"`
+	Username   string `json:"username,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Password   string `json:"password"`
+	Audience   string `json:"audience,omitempty"`
+	Format     string `json:"format,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+	RememberMe bool   `json:"remember_me,omitempty"`
 }
 type Response[T any] struct {
 	Message  string `json:"message"`
@@ -105,6 +130,9 @@ type Response[T any] struct {
 
 type RegisteredClaims struct {
 	jwt.RegisteredClaims
-	UserName string `json:"username,omitempty"`
-	Email    string `json:"email,omitempty"`
+	UserName   string           `json:"username,omitempty"`
+	Email      string           `json:"email,omitempty"`
+	ClientID   string           `json:"client_id,omitempty"`
+	AuthTime   *jwt.NumericDate `json:"auth_time,omitempty"`
+	RememberMe bool             `json:"remember_me,omitempty"`
 }
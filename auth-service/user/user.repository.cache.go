@@ -0,0 +1,192 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sing3demons/auth-service/metrics"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/redis"
+	"github.com/sing3demons/auth-service/store"
+	"golang.org/x/sync/singleflight"
+)
+
+const userCacheKeyPrefix = "user:id:"
+
+// userCacheLoadTimeout bounds a backend lookup shared by concurrent misses.
+// The lookup does not follow any one caller's ctx, so a caller that gives
+// up does not fail the others waiting on it.
+const userCacheLoadTimeout = 5 * time.Second
+
+// CachedUserRepository is a read-through cache in front of another
+// UserRepository. Lookups by ID are served from Redis; concurrent misses for
+// the same ID share a single backend query. Writes go to the backend first
+// and then drop the cached entry; a lookup that was already running when the
+// entry was dropped does not cache what it read.
+//
+// Password hashes are never cached, so users returned by FindByID have no
+// Password. Lookups that need the hash, such as FindByEmail, go to the
+// backend.
+type CachedUserRepository struct {
+	UserRepository
+
+	redis redis.IRedis
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu sync.Mutex
+	// loading holds the backend lookups in flight by user ID. Invalidate
+	// marks them stale.
+	loading map[string]*userLoad
+}
+
+type userLoad struct {
+	stale bool
+}
+
+func NewCachedUserRepository(next UserRepository, redisClient redis.IRedis, ttl time.Duration) *CachedUserRepository {
+	return &CachedUserRepository{UserRepository: next, redis: redisClient, ttl: ttl, loading: map[string]*userLoad{}}
+}
+
+// cachedUser is the cached form of User. It serializes the timestamps User
+// hides from JSON and leaves the password hash out.
+type cachedUser struct {
+	ID       string    `json:"id"`
+	Href     string    `json:"href"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	Roles    []string  `json:"roles"`
+	CreateAt time.Time `json:"create_at"`
+	UpdateAt time.Time `json:"update_at"`
+}
+
+func newCachedUser(u User) cachedUser {
+	return cachedUser{
+		ID:       u.ID,
+		Href:     u.Href,
+		Username: u.Username,
+		Email:    u.Email,
+		Name:     u.Name,
+		Roles:    u.Roles,
+		CreateAt: u.CreateAt,
+		UpdateAt: u.UpdateAt,
+	}
+}
+
+func (c cachedUser) user() User {
+	return User{
+		ID:       c.ID,
+		Href:     c.Href,
+		Username: c.Username,
+		Email:    c.Email,
+		Name:     c.Name,
+		Roles:    c.Roles,
+		CreateAt: c.CreateAt,
+		UpdateAt: c.UpdateAt,
+	}
+}
+
+func userCacheKey(id string) string {
+	return userCacheKeyPrefix + id
+}
+
+func (r *CachedUserRepository) FindByID(ctx context.Context, id string) (User, error) {
+	if value, err := r.redis.Get(ctx, userCacheKey(id)); err == nil {
+		var c cachedUser
+		if err := json.Unmarshal([]byte(value), &c); err == nil {
+			metrics.CacheLookup("user", true)
+			return c.user(), nil
+		}
+	}
+	metrics.CacheLookup("user", false)
+
+	v, err, _ := r.group.Do(id, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), userCacheLoadTimeout)
+		defer cancel()
+
+		load := r.startLoad(id)
+		defer r.endLoad(id)
+
+		user, err := r.UserRepository.FindByID(ctx, id)
+		if err != nil {
+			return User{}, err
+		}
+		c := newCachedUser(user)
+		if value, err := json.Marshal(c); err == nil && !r.isStale(load) {
+			r.redis.SetEx(ctx, userCacheKey(id), value, r.ttl)
+			// an invalidation between the check and the write must win
+			if r.isStale(load) {
+				r.redis.Del(ctx, userCacheKey(id))
+			}
+		}
+		return c.user(), nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return v.(User), nil
+}
+
+func (r *CachedUserRepository) Insert(ctx context.Context, user User) error {
+	if err := r.UserRepository.Insert(ctx, user); err != nil {
+		return err
+	}
+	r.invalidateAfterCommit(ctx, user.ID)
+	return nil
+}
+
+func (r *CachedUserRepository) UpdateProfile(ctx context.Context, id string, update func(profile *Profile) []ProfileLanguage) (Profile, error) {
+	profile, err := r.UserRepository.UpdateProfile(ctx, id, update)
+	if err != nil {
+		return Profile{}, err
+	}
+	r.invalidateAfterCommit(ctx, id)
+	return profile, nil
+}
+
+// invalidateAfterCommit drops the cached copy of user id once the
+// transaction ctx belongs to commits, so a reader cannot cache the old
+// document in between. The write has already succeeded, so a failed
+// invalidation is logged rather than returned; the entry expires with its
+// TTL.
+func (r *CachedUserRepository) invalidateAfterCommit(ctx context.Context, id string) {
+	store.AfterCommit(ctx, func() {
+		if err := r.Invalidate(context.WithoutCancel(ctx), id); err != nil {
+			mlog.L(ctx).Error("user cache invalidation failed", "id", id, "error", err)
+		}
+	})
+}
+
+// Invalidate drops the cached copy of user id. Any write that changes a
+// user's profile, roles or password must call it after committing.
+func (r *CachedUserRepository) Invalidate(ctx context.Context, id string) error {
+	r.mu.Lock()
+	if load, ok := r.loading[id]; ok {
+		load.stale = true
+	}
+	r.mu.Unlock()
+	return r.redis.Del(ctx, userCacheKey(id))
+}
+
+func (r *CachedUserRepository) startLoad(id string) *userLoad {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	load := &userLoad{}
+	r.loading[id] = load
+	return load
+}
+
+func (r *CachedUserRepository) endLoad(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.loading, id)
+}
+
+func (r *CachedUserRepository) isStale(load *userLoad) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return load.stale
+}
@@ -0,0 +1,24 @@
+package user
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// UserRepository is the storage boundary of the user package. Lookups return
+// ErrUserNotFound when no user matches.
+type UserRepository interface {
+	FindByID(ctx context.Context, id string) (User, error)
+	FindByEmail(ctx context.Context, email string) (User, error)
+	FindByUsername(ctx context.Context, username string) (User, error)
+	Insert(ctx context.Context, user User) error
+	// UpdateProfile loads the profile of user id, lets update modify it and
+	// return the per-language profiles, then saves everything atomically.
+	UpdateProfile(ctx context.Context, id string, update func(profile *Profile) []ProfileLanguage) (Profile, error)
+}
+
+func profileLanguageID(userID, languageCode string) string {
+	return userID + "-" + languageCode
+}
@@ -0,0 +1,47 @@
+package user
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func NewMockUserRepository() *MockUserRepository {
+	return &MockUserRepository{}
+}
+
+func (m *MockUserRepository) FindByID(ctx context.Context, id string) (User, error) {
+	ret := m.Called(ctx, id)
+	return ret.Get(0).(User), ret.Error(1)
+}
+
+func (m *MockUserRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	ret := m.Called(ctx, email)
+	return ret.Get(0).(User), ret.Error(1)
+}
+
+func (m *MockUserRepository) FindByUsername(ctx context.Context, username string) (User, error) {
+	ret := m.Called(ctx, username)
+	return ret.Get(0).(User), ret.Error(1)
+}
+
+func (m *MockUserRepository) Insert(ctx context.Context, user User) error {
+	ret := m.Called(ctx, user)
+	return ret.Error(0)
+}
+
+// UpdateProfile runs update against the Profile given as the first return
+// value, so tests can assert on what the service changed.
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id string, update func(profile *Profile) []ProfileLanguage) (Profile, error) {
+	ret := m.Called(ctx, id, update)
+	profile := ret.Get(0).(Profile)
+	if ret.Error(1) != nil {
+		return Profile{}, ret.Error(1)
+	}
+	profile.Languages = update(&profile)
+	return profile, nil
+}
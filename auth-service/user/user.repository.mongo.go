@@ -0,0 +1,125 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sing3demons/auth-service/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRepositoryConfig names the database and collections used by the
+// Mongo user repository. Empty fields fall back to the defaults.
+type MongoRepositoryConfig struct {
+	Database         string
+	Users            string
+	ProfileLanguages string
+}
+
+func DefaultMongoRepositoryConfig() MongoRepositoryConfig {
+	return MongoRepositoryConfig{
+		Database:         "auth",
+		Users:            "users",
+		ProfileLanguages: "profileLanguage",
+	}
+}
+
+type mongoUserRepository struct {
+	store  store.Store
+	config MongoRepositoryConfig
+}
+
+func NewMongoUserRepository(client store.Store) UserRepository {
+	return NewMongoUserRepositoryWithConfig(client, DefaultMongoRepositoryConfig())
+}
+
+func NewMongoUserRepositoryWithConfig(client store.Store, config MongoRepositoryConfig) UserRepository {
+	defaults := DefaultMongoRepositoryConfig()
+	if config.Database == "" {
+		config.Database = defaults.Database
+	}
+	if config.Users == "" {
+		config.Users = defaults.Users
+	}
+	if config.ProfileLanguages == "" {
+		config.ProfileLanguages = defaults.ProfileLanguages
+	}
+	return &mongoUserRepository{client, config}
+}
+
+func (r *mongoUserRepository) users() store.Collection {
+	return r.store.Database(r.config.Database).Collection(r.config.Users)
+}
+
+func (r *mongoUserRepository) profileLanguages() store.Collection {
+	return r.store.Database(r.config.Database).Collection(r.config.ProfileLanguages)
+}
+
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (User, error) {
+	var user User
+	if err := r.users().FindOne(ctx, filter).Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (r *mongoUserRepository) FindByID(ctx context.Context, id string) (User, error) {
+	return r.findOne(ctx, bson.M{"id": id})
+}
+
+func (r *mongoUserRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) FindByUsername(ctx context.Context, username string) (User, error) {
+	return r.findOne(ctx, bson.M{"username": username})
+}
+
+func (r *mongoUserRepository) Insert(ctx context.Context, user User) error {
+	_, err := r.users().InsertOne(ctx, user)
+	return err
+}
+
+func (r *mongoUserRepository) UpdateProfile(ctx context.Context, id string, update func(profile *Profile) []ProfileLanguage) (Profile, error) {
+	var profile Profile
+	err := store.WithTransaction(ctx, r.store, func(ctx context.Context) error {
+		p, err := r.updateProfile(ctx, id, update)
+		profile = p
+		return err
+	})
+	return profile, err
+}
+
+func (r *mongoUserRepository) updateProfile(ctx context.Context, id string, update func(profile *Profile) []ProfileLanguage) (Profile, error) {
+	profile := Profile{}
+	if err := r.users().FindOne(ctx, bson.M{"id": id}).Decode(&profile); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Profile{}, ErrUserNotFound
+		}
+		return Profile{}, err
+	}
+
+	languages := update(&profile)
+	profile.ID = id
+
+	if _, err := r.users().UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": profile}); err != nil {
+		return Profile{}, err
+	}
+
+	for _, lang := range languages {
+		lang.ID = profileLanguageID(id, lang.LanguageCode)
+		lang.Ref = id
+		_, err := r.profileLanguages().UpdateOne(ctx, bson.M{"id": lang.ID}, bson.M{"$set": lang}, options.Update().SetUpsert(true))
+		if err != nil {
+			return Profile{}, err
+		}
+		profile.Languages = append(profile.Languages, lang)
+	}
+
+	return profile, nil
+}
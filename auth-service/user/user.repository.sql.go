@@ -0,0 +1,123 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/sing3demons/auth-service/sqlstore"
+)
+
+type sqlUserRepository struct {
+	db *sqlstore.DB
+}
+
+// NewSQLUserRepository stores users in SQLite or PostgreSQL. The schema is
+// created by (*sqlstore.DB).Migrate.
+func NewSQLUserRepository(db *sqlstore.DB) UserRepository {
+	return &sqlUserRepository{db}
+}
+
+const selectUser = `SELECT id, username, email, password, name, roles, create_at, update_at FROM users`
+
+func (r *sqlUserRepository) findOne(ctx context.Context, where string, arg string) (User, error) {
+	var (
+		user     User
+		username sql.NullString
+		email    sql.NullString
+		roles    string
+	)
+	row := r.db.QueryRowContext(ctx, r.db.Rebind(selectUser+" WHERE "+where+" = ?"), arg)
+	if err := row.Scan(&user.ID, &username, &email, &user.Password, &user.Name, &roles, &user.CreateAt, &user.UpdateAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	user.Username = username.String
+	user.Email = email.String
+	if err := json.Unmarshal([]byte(roles), &user.Roles); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (r *sqlUserRepository) FindByID(ctx context.Context, id string) (User, error) {
+	return r.findOne(ctx, "id", id)
+}
+
+func (r *sqlUserRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	return r.findOne(ctx, "email", email)
+}
+
+func (r *sqlUserRepository) FindByUsername(ctx context.Context, username string) (User, error) {
+	return r.findOne(ctx, "username", username)
+}
+
+func (r *sqlUserRepository) Insert(ctx context.Context, user User) error {
+	roles, err := json.Marshal(user.Roles)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, r.db.Rebind(`INSERT INTO users (id, username, email, password, name, roles, create_at, update_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		user.ID, nullString(user.Username), nullString(user.Email), user.Password, user.Name, string(roles), user.CreateAt, user.UpdateAt)
+	return err
+}
+
+func (r *sqlUserRepository) UpdateProfile(ctx context.Context, id string, update func(profile *Profile) []ProfileLanguage) (Profile, error) {
+	var profile Profile
+	err := r.db.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `SELECT id, first_name, last_name, description, phone, address, update_date FROM users WHERE id = ?`
+		if r.db.Dialect == sqlstore.Postgres {
+			query += " FOR UPDATE"
+		}
+		row := tx.QueryRowContext(ctx, r.db.Rebind(query), id)
+		if err := row.Scan(&profile.ID, &profile.FirstName, &profile.LastName, &profile.Description, &profile.Phone, &profile.Address, &profile.UpdateDate); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		languages := update(&profile)
+		profile.ID = id
+
+		if _, err := tx.ExecContext(ctx, r.db.Rebind(`UPDATE users SET first_name = ?, last_name = ?, description = ?, phone = ?, address = ?, update_date = ? WHERE id = ?`),
+			profile.FirstName, profile.LastName, profile.Description, profile.Phone, profile.Address, profile.UpdateDate, id); err != nil {
+			return err
+		}
+
+		for _, lang := range languages {
+			lang.ID = profileLanguageID(id, lang.LanguageCode)
+			lang.Ref = id
+			attachments, err := json.Marshal(lang.Attachments)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, r.db.Rebind(`INSERT INTO profile_languages (id, user_id, language_code, first_name, last_name, description, attachments, create_date, update_date)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (user_id, language_code) DO UPDATE SET
+					first_name = excluded.first_name,
+					last_name = excluded.last_name,
+					description = excluded.description,
+					attachments = excluded.attachments,
+					update_date = excluded.update_date`),
+				lang.ID, id, lang.LanguageCode, lang.FirstName, lang.LastName, lang.Description, string(attachments), lang.CreateDate, lang.UpdateDate); err != nil {
+				return err
+			}
+			profile.Languages = append(profile.Languages, lang)
+		}
+		return nil
+	})
+	if err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
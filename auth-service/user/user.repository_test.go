@@ -0,0 +1,305 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/changestream"
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/sing3demons/auth-service/redis"
+	"github.com/sing3demons/auth-service/sqlstore"
+	"github.com/sing3demons/auth-service/store"
+	"github.com/sing3demons/auth-service/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newSQLiteRepository(t *testing.T) (user.UserRepository, *sqlstore.DB) {
+	ctx := context.TODO()
+	db, err := sqlstore.Open(ctx, sqlstore.SQLite, ":memory:")
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	assert.NoError(t, db.Migrate(ctx))
+	// migrations are idempotent
+	assert.NoError(t, db.Migrate(ctx))
+
+	return user.NewSQLUserRepository(db), db
+}
+
+func testRepository(t *testing.T, repository user.UserRepository) {
+	ctx := context.TODO()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	err := repository.Insert(ctx, user.User{
+		ID:       subject,
+		Username: mockUserName,
+		Email:    mockEmail,
+		Password: mockPassword,
+		Roles:    []string{"user"},
+		CreateAt: now,
+		UpdateAt: now,
+	})
+	assert.NoError(t, err)
+
+	u, err := repository.FindByEmail(ctx, mockEmail)
+	assert.NoError(t, err)
+	assert.Equal(t, subject, u.ID)
+	assert.Equal(t, []string{"user"}, u.Roles)
+	assert.True(t, now.Equal(u.CreateAt))
+
+	u, err = repository.FindByUsername(ctx, mockUserName)
+	assert.NoError(t, err)
+	assert.Equal(t, mockEmail, u.Email)
+
+	_, err = repository.FindByID(ctx, "unknown")
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+
+	profile, err := repository.UpdateProfile(ctx, subject, func(p *user.Profile) []user.ProfileLanguage {
+		p.FirstName = "first"
+		p.Phone = "0800000000"
+		return []user.ProfileLanguage{
+			{LanguageCode: "th", FirstName: "ชื่อ"},
+			{LanguageCode: "en", FirstName: "first"},
+		}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "first", profile.FirstName)
+	assert.Len(t, profile.Languages, 2)
+
+	profile, err = repository.UpdateProfile(ctx, subject, func(p *user.Profile) []user.ProfileLanguage {
+		assert.Equal(t, "first", p.FirstName)
+		assert.Equal(t, "0800000000", p.Phone)
+		return []user.ProfileLanguage{{LanguageCode: "en", FirstName: "second"}}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, subject+"-en", profile.Languages[0].ID)
+
+	_, err = repository.UpdateProfile(ctx, "unknown", func(p *user.Profile) []user.ProfileLanguage { return nil })
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+}
+
+func TestSQLUserRepository(t *testing.T) {
+	repository, _ := newSQLiteRepository(t)
+	testRepository(t, repository)
+}
+
+func TestSQLUserRepositoryForeignKeys(t *testing.T) {
+	ctx := context.TODO()
+	_, db := newSQLiteRepository(t)
+
+	_, err := db.ExecContext(ctx, `INSERT INTO profile_languages (id, user_id, language_code) VALUES ('1', 'unknown', 'en')`)
+	assert.Error(t, err)
+}
+
+func TestMongoUserRepository(t *testing.T) {
+	testRepository(t, user.NewMongoUserRepository(store.NewMemoryStore()))
+}
+
+func TestSQLUserRepositoryUpdateProfileRollback(t *testing.T) {
+	ctx := context.TODO()
+	repository, db := newSQLiteRepository(t)
+
+	assert.NoError(t, repository.Insert(ctx, user.User{ID: subject, Email: mockEmail, Password: mockPassword, CreateAt: time.Now(), UpdateAt: time.Now()}))
+
+	_, err := db.ExecContext(ctx, `ALTER TABLE profile_languages RENAME TO profile_languages_old`)
+	assert.NoError(t, err)
+
+	_, err = repository.UpdateProfile(ctx, subject, func(p *user.Profile) []user.ProfileLanguage {
+		p.FirstName = "lost"
+		return []user.ProfileLanguage{{LanguageCode: "en"}}
+	})
+	assert.Error(t, err)
+
+	var firstName string
+	assert.NoError(t, db.QueryRowContext(ctx, `SELECT first_name FROM users WHERE id = ?`, subject).Scan(&firstName))
+	assert.Equal(t, "", firstName)
+}
+
+func TestMongoUserRepositoryConfig(t *testing.T) {
+	ctx := context.TODO()
+	db := store.NewMemoryStore()
+	repository := user.NewMongoUserRepositoryWithConfig(db, user.MongoRepositoryConfig{
+		Database: "identity",
+		Users:    "accounts",
+	})
+
+	assert.NoError(t, repository.Insert(ctx, user.User{ID: subject, Email: mockEmail}))
+
+	var u user.User
+	assert.NoError(t, db.Database("identity").Collection("accounts").FindOne(ctx, map[string]string{"id": subject}).Decode(&u))
+	assert.Equal(t, mockEmail, u.Email)
+
+	_, err := user.NewMongoUserRepository(db).FindByID(ctx, subject)
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+}
+
+func TestGetUserWithRepository(t *testing.T) {
+	ctx := context.TODO()
+	repository := user.NewMockUserRepository()
+	repository.On("FindByID", ctx, subject).Return(user.User{}, user.ErrUserNotFound)
+
+	service := user.NewUserServiceWithConfig(repository, new(redis.MockRedis), keys.NewProvider(keys.EnvSource{}), user.Config{})
+	_, err := service.GetUser(ctx, slog.Default(), subject)
+
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+	repository.AssertExpectations(t)
+}
+
+func TestCachedUserRepository(t *testing.T) {
+	ctx := context.TODO()
+	cached := user.User{ID: subject, Email: mockEmail, Password: "$2a$10$hash", Roles: []string{"user"}, CreateAt: time.Now().UTC()}
+
+	t.Run("read through and invalidate", func(t *testing.T) {
+		backend := user.NewMockUserRepository()
+		backend.On("FindByID", mock.Anything, subject).Return(cached, nil).Twice()
+		backend.On("UpdateProfile", ctx, subject, mock.Anything).Return(user.Profile{ID: subject}, nil).Once()
+
+		cache := redis.NewMemory()
+		defer cache.Close()
+		repository := user.NewCachedUserRepository(backend, cache, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			u, err := repository.FindByID(ctx, subject)
+			assert.NoError(t, err)
+			assert.Equal(t, mockEmail, u.Email)
+			assert.True(t, cached.CreateAt.Equal(u.CreateAt))
+			assert.Empty(t, u.Password, "password hashes are not cached")
+		}
+		value, err := cache.Get(ctx, "user:id:"+subject)
+		assert.NoError(t, err)
+		assert.NotContains(t, value, "hash")
+
+		_, err = repository.UpdateProfile(ctx, subject, func(p *user.Profile) []user.ProfileLanguage { return nil })
+		assert.NoError(t, err)
+
+		_, err = repository.FindByID(ctx, subject)
+		assert.NoError(t, err)
+		backend.AssertExpectations(t)
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		backend := user.NewMockUserRepository()
+		backend.On("FindByID", mock.Anything, subject).Return(user.User{}, user.ErrUserNotFound).Twice()
+
+		cache := redis.NewMemory()
+		defer cache.Close()
+		repository := user.NewCachedUserRepository(backend, cache, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			_, err := repository.FindByID(ctx, subject)
+			assert.ErrorIs(t, err, user.ErrUserNotFound)
+		}
+		backend.AssertExpectations(t)
+	})
+
+	t.Run("concurrent misses share one lookup", func(t *testing.T) {
+		backend := user.NewMockUserRepository()
+		backend.On("FindByID", mock.Anything, subject).After(50*time.Millisecond).Return(cached, nil).Once()
+
+		cache := redis.NewMemory()
+		defer cache.Close()
+		repository := user.NewCachedUserRepository(backend, cache, time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repository.FindByID(ctx, subject)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		backend.AssertExpectations(t)
+	})
+
+	t.Run("a lookup racing an invalidation is not cached", func(t *testing.T) {
+		loading, release := make(chan struct{}), make(chan struct{})
+		backend := user.NewMockUserRepository()
+		backend.On("FindByID", mock.Anything, subject).Run(func(mock.Arguments) {
+			close(loading)
+			<-release
+		}).Return(cached, nil).Once()
+
+		cache := redis.NewMemory()
+		defer cache.Close()
+		repository := user.NewCachedUserRepository(backend, cache, time.Minute)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := repository.FindByID(ctx, subject)
+			assert.NoError(t, err)
+		}()
+		<-loading
+		assert.NoError(t, repository.Invalidate(ctx, subject))
+		close(release)
+		<-done
+
+		_, err := cache.Get(ctx, "user:id:"+subject)
+		assert.Error(t, err, "the user read before the invalidation is stale")
+		backend.AssertExpectations(t)
+	})
+
+	t.Run("writes invalidate after the transaction commits", func(t *testing.T) {
+		backend := user.NewMockUserRepository()
+		backend.On("FindByID", mock.Anything, subject).Return(cached, nil).Once()
+		backend.On("Insert", mock.Anything, mock.Anything).Return(nil).Once()
+
+		cache := redis.NewMemory()
+		defer cache.Close()
+		repository := user.NewCachedUserRepository(backend, cache, time.Minute)
+		_, err := repository.FindByID(ctx, subject)
+		assert.NoError(t, err)
+
+		err = store.WithTransaction(ctx, store.NewMemoryStore(), func(ctx context.Context) error {
+			assert.NoError(t, repository.Insert(ctx, cached))
+			_, err := cache.Get(ctx, "user:id:"+subject)
+			assert.NoError(t, err, "still cached until the commit")
+			return nil
+		})
+		assert.NoError(t, err)
+		_, err = cache.Get(ctx, "user:id:"+subject)
+		assert.Error(t, err)
+		backend.AssertExpectations(t)
+	})
+
+	t.Run("a failed invalidation does not fail the write", func(t *testing.T) {
+		backend := user.NewMockUserRepository()
+		backend.On("Insert", ctx, cached).Return(nil).Once()
+		cache := new(redis.MockRedis)
+		cache.On("Del", mock.Anything, "user:id:"+subject).Return(errors.New("redis down")).Once()
+
+		repository := user.NewCachedUserRepository(backend, cache, time.Minute)
+		assert.NoError(t, repository.Insert(ctx, cached))
+		cache.AssertExpectations(t)
+	})
+
+	t.Run("changes from other replicas invalidate", func(t *testing.T) {
+		backend := user.NewMockUserRepository()
+		backend.On("FindByID", mock.Anything, subject).Return(cached, nil).Twice()
+
+		cache := redis.NewMemory()
+		defer cache.Close()
+		repository := user.NewCachedUserRepository(backend, cache, time.Minute)
+
+		_, err := repository.FindByID(ctx, subject)
+		assert.NoError(t, err)
+		// a delete without a pre-image carries no user ID
+		assert.NoError(t, repository.HandleChange(ctx, changestream.Change{Operation: changestream.Delete}))
+		_, err = repository.FindByID(ctx, subject)
+		assert.NoError(t, err)
+
+		doc, _ := bson.Marshal(bson.M{"id": subject, "email": mockEmail})
+		assert.NoError(t, repository.HandleChange(ctx, changestream.Change{Operation: changestream.Update, FullDocument: doc}))
+		_, err = repository.FindByID(ctx, subject)
+		assert.NoError(t, err)
+		backend.AssertExpectations(t)
+	})
+}
@@ -1,21 +1,22 @@
 package user
 
 import (
-	"encoding/base64"
 	"log/slog"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/auth-service/audit"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/sing3demons/auth-service/mlog"
 	"github.com/sing3demons/auth-service/redis"
 	"github.com/sing3demons/auth-service/router"
-	"github.com/sing3demons/auth-service/store"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func Authorization() gin.HandlerFunc {
+func Authorization(keyring keys.Keyring) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		s := c.Request.Header.Get("Authorization")
 		if s == "" {
@@ -28,46 +29,70 @@ func Authorization() gin.HandlerFunc {
 			return
 		}
 
-		public := os.Getenv("PUBLIC_ACCESS_KEY")
-
-		if public == "" {
+		key, err := keyring.VerificationKey(keys.Access, keys.HeaderKeyID(token))
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
 			return
 		}
 
-		publicKey, err := base64.StdEncoding.DecodeString(public)
+		claims, err := parseToken(key, token)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
 			return
 		}
-		rsa, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
-		if err != nil {
+		c.Set("token", claims)
+		c.Set(mlog.UserIDKey, claims.Subject)
+
+		c.Next()
+	}
+}
+
+// RequireRole lets the request through when the user authenticated by
+// Authorization holds one of roles. Roles are not in the token, so they are
+// read from repository.
+func RequireRole(repository UserRepository, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("token")
+		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
 			return
 		}
-
-		t, err := jwt.ParseWithClaims(token, &RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-			return rsa, nil
-		})
-
+		user, err := repository.FindByID(c.Request.Context(), claims.(*RegisteredClaims).Subject)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "forbidden"})
 			return
 		}
-		claims := t.Claims.(*RegisteredClaims)
-		c.Set("token", claims)
-
-		c.Next()
+		for _, role := range roles {
+			if slices.Contains(user.Roles, role) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "forbidden"})
 	}
 }
 
-func Register(r router.MyRouter, client *mongo.Client, redisClient redis.IRedis, logger *slog.Logger) router.MyRouter {
+// Config configures the user routes and service. HostURL builds the links
+// in responses; the other fields are described at NewUserServiceWithConfig.
+type Config struct {
+	HostURL string
+	// Tokens holds the token configuration; nil uses DefaultTokenConfig.
+	Tokens *Tokens
+	// Audit receives login and refresh events; nil discards them.
+	Audit audit.Recorder
+	// Events receives user lifecycle events; nil discards them.
+	Events events.Publisher
+	// PublishTimeout bounds a direct publish from the request path; zero
+	// uses DefaultPublishTimeout.
+	PublishTimeout time.Duration
+}
+
+func Register(r router.MyRouter, repository UserRepository, redisClient redis.IRedis, keyring keys.Keyring, config Config, logger *slog.Logger) router.MyRouter {
 	logger.Info("Register user routes")
 
-	storer := store.New(client)
-	userService := NewUserService(storer, redisClient)
-	userHandler := NewUserHandler(userService, logger)
-	authMiddleware := Authorization()
+	userService := NewTracedUserService(NewUserServiceWithConfig(repository, redisClient, keyring, config))
+	userHandler := NewUserHandlerWithHostURL(userService, logger, config.HostURL)
+	authMiddleware := Authorization(keyring)
 	v1 := r.Group("/api/v1")
 
 	v1.POST("/auth/register", userHandler.Register)
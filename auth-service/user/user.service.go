@@ -2,18 +2,18 @@ package user
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"log/slog"
-	"os"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/sing3demons/auth-service/audit"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/sing3demons/auth-service/metrics"
 	"github.com/sing3demons/auth-service/redis"
 	"github.com/sing3demons/auth-service/store"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -26,40 +26,122 @@ type UserService interface {
 }
 
 type userService struct {
-	store store.Store
-	redis redis.IRedis
+	repository UserRepository
+	redis      redis.IRedis
+	keys       keys.Keyring
+	tokens     *Tokens
+	audit      audit.Recorder
+	events     events.Publisher
+	// publishTimeout bounds a direct publish so that a broker outage does
+	// not stall the request.
+	publishTimeout time.Duration
 }
 
+const DefaultPublishTimeout = 2 * time.Second
+
 func NewUserService(client store.Store, redisClient redis.IRedis) UserService {
-	return &userService{client, redisClient}
+	return NewUserServiceWithConfig(NewMongoUserRepository(client), redisClient, keys.NewProvider(keys.EnvSource{}), Config{})
 }
 
-const (
-	ErrTokenInvalid = "token invalid"
-)
+// NewUserServiceWithConfig builds a user service on repository. config
+// supplies the optional dependencies: Tokens is read on every login and
+// refresh, so it can be changed while the service runs; Audit records
+// logins and refreshes; Events receives user lifecycle events. Nil fields
+// fall back to the defaults.
+func NewUserServiceWithConfig(repository UserRepository, redisClient redis.IRedis, keyring keys.Keyring, config Config) UserService {
+	if config.Tokens == nil {
+		config.Tokens = NewTokens(DefaultTokenConfig())
+	}
+	if config.Audit == nil {
+		config.Audit = audit.Discard
+	}
+	if config.Events == nil {
+		config.Events = events.Discard
+	}
+	if config.PublishTimeout <= 0 {
+		config.PublishTimeout = DefaultPublishTimeout
+	}
+	return &userService{repository, redisClient, keyring, config.Tokens, config.Audit, config.Events, config.PublishTimeout}
+}
 
-func (u *userService) VerifyAccessToken(logger *slog.Logger, token string) (*TokenResponse, error) {
-	public := os.Getenv("PUBLIC_ACCESS_KEY")
+// publish sends event once the change it describes is stored. A failed or
+// timed out publish is logged and does not fail the request.
+func (u *userService) publish(ctx context.Context, logger *slog.Logger, event events.Event) {
+	ctx, cancel := context.WithTimeout(ctx, u.publishTimeout)
+	defer cancel()
+	if err := u.events.Publish(ctx, event); err != nil {
+		logger.Error("publish event failed", "type", event.Type, "id", event.ID, "error", err)
+	}
+}
 
-	if public == "" {
-		return nil, errors.New("public key not found")
+// TransactionalPublisher stores events in the same transaction as the user
+// writes made with the ctx its Transaction passes on, such as an outbox.
+type TransactionalPublisher interface {
+	events.Publisher
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// commit runs write and publishes the events it returns. With a
+// TransactionalPublisher the write and the events commit together;
+// otherwise the events are published after the write and a failed publish
+// is only logged.
+func (u *userService) commit(ctx context.Context, logger *slog.Logger, write func(ctx context.Context) ([]events.Event, error)) error {
+	if tx, ok := u.events.(TransactionalPublisher); ok {
+		return tx.Transaction(ctx, func(ctx context.Context) error {
+			evts, err := write(ctx)
+			if err != nil {
+				return err
+			}
+			return tx.Publish(ctx, evts...)
+		})
 	}
 
-	publicKey, err := base64.StdEncoding.DecodeString(public)
+	evts, err := write(ctx)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	for _, event := range evts {
+		u.publish(ctx, logger, event)
 	}
+	return nil
+}
 
-	rsa, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
-	if err != nil {
-		return nil, err
+// record writes event to the audit log. A failed write is logged and does
+// not fail the request.
+func (u *userService) record(ctx context.Context, logger *slog.Logger, event audit.Event) {
+	if err := u.audit.Record(ctx, event); err != nil {
+		logger.Error("audit record failed", "type", event.Type, "error", err)
 	}
+}
 
-	t, err := jwt.ParseWithClaims(token, &RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return rsa, nil
+func (u *userService) loginFailed(ctx context.Context, logger *slog.Logger, body Login, user User, reason string) {
+	metrics.LoginFailed(reason)
+	identifier := body.Email
+	if body.Username != "" {
+		identifier = body.Username
+	}
+	u.record(ctx, logger, audit.Event{
+		Type:    audit.LoginFailed,
+		ActorID: user.ID,
+		Reason:  reason,
+		Details: map[string]string{"identifier": identifier, "client_id": body.ClientID},
 	})
+}
+
+const (
+	ErrTokenInvalid = "token invalid"
+)
+
+func (u *userService) VerifyAccessToken(logger *slog.Logger, token string) (*TokenResponse, error) {
+	key, err := u.keys.VerificationKey(keys.Access, keys.HeaderKeyID(token))
+	if err != nil {
+		metrics.TokenVerified(err)
+		return nil, err
+	}
 
-	if err != nil || !t.Valid {
+	_, err = parseToken(key, token)
+	metrics.TokenVerified(err)
+	if err != nil {
 		return nil, errors.New(ErrTokenInvalid)
 	}
 
@@ -67,87 +149,120 @@ func (u *userService) VerifyAccessToken(logger *slog.Logger, token string) (*Tok
 }
 
 func (u *userService) verifyRefreshToken(token string) (jwt.Claims, error) {
-	public := os.Getenv("PUBLIC_REFRESH_KEY")
-	if public == "" {
-		return nil, errors.New("public key not found")
-	}
-
-	publicKey, err := base64.StdEncoding.DecodeString(public)
-	if err != nil {
-		return nil, err
-	}
-	rsa, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
+	key, err := u.keys.VerificationKey(keys.Refresh, keys.HeaderKeyID(token))
 	if err != nil {
 		return nil, err
 	}
 
-	t, err := jwt.ParseWithClaims(token, &RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return rsa, nil
-	})
-
+	claims, err := parseToken(key, token)
 	if err != nil {
 		return nil, err
 	}
 
-	return t.Claims, nil
+	return claims, nil
 }
 
 func (u *userService) Login(ctx context.Context, logger *slog.Logger, body Login) (*TokenResponse, error) {
 	logger.Info("userService Login")
-	db := u.store.Database("auth").Collection("users")
 	var user User
 	if body.Email != "" {
-		if err := db.FindOne(ctx, bson.M{"email": body.Email}).Decode(&user); err != nil {
+		found, err := u.repository.FindByEmail(ctx, body.Email)
+		if err != nil {
+			u.loginFailed(ctx, logger, body, user, "user_not_found")
 			msg := errors.New("user not found")
 			logger.Error(msg.Error())
 			return nil, msg
 		}
+		user = found
 	}
 
 	if body.Username != "" {
-		if err := db.FindOne(ctx, bson.M{"username": body.Username}).Decode(&user); err != nil {
+		found, err := u.repository.FindByUsername(ctx, body.Username)
+		if err != nil {
+			u.loginFailed(ctx, logger, body, user, "user_not_found")
 			msg := errors.New("user not found")
 			logger.Error(msg.Error())
 			return nil, msg
 		}
+		user = found
 	}
 
 	if err := u.comparePassword(user.Password, body.Password); err != nil {
+		u.loginFailed(ctx, logger, body, user, "invalid_password")
 		logger.Error(err.Error())
 		return nil, err
 	}
 
+	tokens := u.tokens.Load()
+	if err := tokens.audience(body.Audience); err != nil {
+		u.loginFailed(ctx, logger, body, user, "invalid_audience")
+		logger.Error(err.Error())
+		return nil, err
+	}
+	if err := tokens.client(body.ClientID); err != nil {
+		u.loginFailed(ctx, logger, body, user, "invalid_client")
+		logger.Error(err.Error())
+		return nil, err
+	}
+	format, err := tokens.format(body.Format, body.Audience)
+	if err != nil {
+		u.loginFailed(ctx, logger, body, user, "invalid_format")
+		logger.Error(err.Error())
+		return nil, err
+	}
+	now := time.Now()
+	request := tokenRequest{
+		format:     format,
+		clientID:   body.ClientID,
+		rememberMe: body.RememberMe,
+		authTime:   now,
+		issuedAt:   now,
+	}
+	if body.Audience != "" {
+		request.audience = jwt.ClaimStrings{body.Audience}
+	}
+	request.issuer, request.expiry = tokens.Issuer, tokens.expiry(request)
+
 	var token TokenResponse
 
-	accessToken, err := u.generateAccessToken(user)
+	accessToken, err := u.generateAccessToken(ctx, user, request)
 	if err != nil {
+		u.loginFailed(ctx, logger, body, user, "token_error")
 		logger.Error(err.Error())
 		return nil, errors.New("generate access token failed")
 	}
 	token.AccessToken = accessToken
 
-	refreshToken, err := u.generateRefreshToken(user)
+	refreshToken, err := u.generateRefreshToken(ctx, user, request)
 	if err != nil {
+		u.loginFailed(ctx, logger, body, user, "token_error")
 		logger.Error(err.Error())
 		return nil, errors.New("generate refresh token failed")
 	}
 	token.RefreshToken = refreshToken
 
-	if err := u.redis.SetEx(ctx, refreshToken, "true", time.Minute*60); err != nil {
+	if err := u.redis.SetEx(ctx, refreshToken, "true", request.expiry.refreshTTL); err != nil {
+		u.loginFailed(ctx, logger, body, user, "session_store_error")
 		logger.Error(err.Error())
 		return nil, err
 	}
 
+	metrics.LoginSucceeded()
+	u.record(ctx, logger, audit.Event{
+		Type:    audit.LoginSucceeded,
+		ActorID: user.ID,
+		Details: map[string]string{"client_id": body.ClientID},
+	})
+	u.publish(ctx, logger, events.New(events.UserLoggedIn, user.ID, events.LoggedIn{ID: user.ID, ClientID: body.ClientID}))
 	return &token, nil
 
 }
 
 func (u *userService) CreateUser(ctx context.Context, logger *slog.Logger, body User) (User, error) {
 	logger.Info("userService Create user")
-	db := u.store.Database("auth").Collection("users")
 
 	if body.Username != "" {
-		if err := db.FindOne(ctx, bson.M{"username": body.Username}).Decode(&User{}); err == nil {
+		if _, err := u.repository.FindByUsername(ctx, body.Username); err == nil {
 			msg := errors.New("username already exists")
 			logger.Error(msg.Error())
 			return User{}, msg
@@ -156,7 +271,7 @@ func (u *userService) CreateUser(ctx context.Context, logger *slog.Logger, body
 	}
 
 	if body.Email != "" {
-		if err := db.FindOne(ctx, bson.M{"email": body.Email}).Decode(&User{}); err == nil {
+		if _, err := u.repository.FindByEmail(ctx, body.Email); err == nil {
 			msg := errors.New("email already exists")
 			logger.Error(msg.Error())
 			return User{}, msg
@@ -181,12 +296,23 @@ func (u *userService) CreateUser(ctx context.Context, logger *slog.Logger, body
 		CreateAt: time.Now(),
 	}
 
-	r, err := db.InsertOne(ctx, user)
+	err = u.commit(ctx, logger, func(ctx context.Context) ([]events.Event, error) {
+		if err := u.repository.Insert(ctx, user); err != nil {
+			return nil, err
+		}
+		return []events.Event{events.New(events.UserRegistered, user.ID, events.Registered{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			Roles:     user.Roles,
+			CreatedAt: user.CreateAt,
+		})}, nil
+	})
 	if err != nil {
 		logger.Error(err.Error())
 		return User{}, err
 	}
-	logger.Info("Create user success", "id", r.InsertedID)
+	logger.Info("Create user success", "id", user.ID)
 
 	return user, nil
 
@@ -194,12 +320,9 @@ func (u *userService) CreateUser(ctx context.Context, logger *slog.Logger, body
 
 func (u *userService) GetUser(ctx context.Context, logger *slog.Logger, id string) (User, error) {
 	logger.Info("userService Get user", "id", id)
-	col := u.store.Database("auth")
-	db := col.Collection("users")
-	var user User
 
-	singleResult := db.FindOne(ctx, bson.M{"id": id})
-	if err := singleResult.Decode(&user); err != nil {
+	user, err := u.repository.FindByID(ctx, id)
+	if err != nil {
 		logger.Error(err.Error())
 		return User{}, err
 	}
@@ -209,6 +332,12 @@ func (u *userService) GetUser(ctx context.Context, logger *slog.Logger, id strin
 }
 
 func (u *userService) RefreshToken(ctx context.Context, logger *slog.Logger, token string) (*TokenResponse, error) {
+	response, err := u.refreshToken(ctx, logger, token)
+	metrics.TokenRefreshed(err)
+	return response, err
+}
+
+func (u *userService) refreshToken(ctx context.Context, logger *slog.Logger, token string) (*TokenResponse, error) {
 	c, err := u.verifyRefreshToken(token)
 	if err != nil {
 		logger.Error(err.Error())
@@ -221,6 +350,27 @@ func (u *userService) RefreshToken(ctx context.Context, logger *slog.Logger, tok
 		return nil, errors.New(ErrTokenInvalid)
 	}
 
+	// the new pair keeps the client, session and format of the refresh token
+	request := tokenRequest{
+		audience:   customClaims.Audience,
+		format:     tokenFormat(token),
+		clientID:   customClaims.ClientID,
+		rememberMe: customClaims.RememberMe,
+		authTime:   time.Now(),
+		issuedAt:   time.Now(),
+	}
+	if customClaims.AuthTime != nil {
+		request.authTime = customClaims.AuthTime.Time
+	} else if customClaims.IssuedAt != nil {
+		request.authTime = customClaims.IssuedAt.Time
+	}
+	tokens := u.tokens.Load()
+	request.issuer, request.expiry = tokens.Issuer, tokens.expiry(request)
+	if request.expiry.refreshTTL <= 0 {
+		logger.Error(ErrSessionExpired.Error())
+		return nil, ErrSessionExpired
+	}
+
 	intCmdVal, err := u.redis.Exists(ctx, token)
 	if err != nil {
 		logger.Error(err.Error())
@@ -244,7 +394,7 @@ func (u *userService) RefreshToken(ctx context.Context, logger *slog.Logger, tok
 
 	var response TokenResponse
 
-	accessToken, err := u.generateAccessToken(user)
+	accessToken, err := u.generateAccessToken(ctx, user, request)
 	if err != nil {
 		logger.Error(err.Error())
 		return nil, errors.New("generate access token failed")
@@ -252,127 +402,113 @@ func (u *userService) RefreshToken(ctx context.Context, logger *slog.Logger, tok
 
 	response.AccessToken = accessToken
 
-	refreshToken, err := u.generateRefreshToken(user)
+	refreshToken, err := u.generateRefreshToken(ctx, user, request)
 	if err != nil {
 		logger.Error(err.Error())
 		return nil, errors.New("generate refresh token failed")
 	}
 
-	if err := u.redis.SetEx(ctx, refreshToken, "true", time.Minute*60); err != nil {
+	if err := u.redis.SetEx(ctx, refreshToken, "true", request.expiry.refreshTTL); err != nil {
 		logger.Error(err.Error())
 		return nil, err
 	}
 
 	response.RefreshToken = refreshToken
 
+	u.record(ctx, logger, audit.Event{
+		Type:    audit.TokenRefreshed,
+		ActorID: user.ID,
+		Details: map[string]string{"client_id": request.clientID},
+	})
 	return &response, nil
 }
 
 func (u *userService) UpdateUser(ctx context.Context, logger *slog.Logger, body UpdateProfile) (any, error) {
-	session, err := u.store.StartSession()
-	if err != nil {
-		logger.Error(err.Error())
-		return nil, err
-	}
-
-	session.StartTransaction()
-	defer session.EndSession(ctx)
+	update := func(users *Profile) []ProfileLanguage {
+		profileTH := &ProfileLanguage{}
+		profileEN := &ProfileLanguage{}
+		profileEN.LanguageCode = "en"
 
-	dbProfile := u.store.Database("auth").Collection("profileLanguage")
-
-	profileLanguage := []ProfileLanguage{}
-	profileTH := &ProfileLanguage{}
-	profileEN := &ProfileLanguage{}
-	profileEN.LanguageCode = "en"
+		if body.FirstNameTH != "" {
+			profileTH.FirstName = body.FirstNameTH
+		}
 
-	if body.FirstNameTH != "" {
-		profileTH.FirstName = body.FirstNameTH
-	}
+		if body.FirstName != "" {
+			users.FirstName = body.FirstName
+			profileEN.FirstName = body.FirstName
+		}
 
-	dbUser := u.store.Database("auth").Collection("users")
-	users := Profile{}
-	if err := dbUser.FindOne(ctx, bson.M{"id": body.ID}).Decode(&users); err != nil {
-		logger.Error(err.Error())
-		session.AbortTransaction(ctx)
+		if body.LastName != "" {
+			users.LastName = body.LastName
+			profileEN.LastName = body.LastName
+		}
 
-		return nil, err
-	}
+		if body.Description != "" {
+			users.Description = body.Description
+			profileEN.Description = body.Description
+		}
 
-	if body.FirstName != "" {
-		users.FirstName = body.FirstName
-		profileEN.FirstName = body.FirstName
-	}
+		if body.Phone != "" {
+			users.Phone = body.Phone
+		}
 
-	if body.LastName != "" {
-		users.LastName = body.LastName
-		profileEN.LastName = body.LastName
-	}
+		if body.Address != "" {
+			users.Address = body.Address
+		}
 
-	if body.Description != "" {
-		users.Description = body.Description
-		profileEN.Description = body.Description
-	}
+		users.UpdateDate = time.Now().String()
 
-	if body.Phone != "" {
-		users.Phone = body.Phone
-	}
+		if body.ProfileImage != "" {
+			profileEN.Attachments = append(profileEN.Attachments, Attachment{
+				ID:   uuid.New().String(),
+				Name: "profileImage",
+				URL:  body.ProfileImage,
+				Type: "image",
+			})
+		}
 
-	if body.Address != "" {
-		users.Address = body.Address
+		profileTH.LanguageCode = "th"
+		return []ProfileLanguage{*profileTH, *profileEN}
 	}
 
-	users.UpdateDate = time.Now().String()
-
-	updateResult, err := dbUser.UpdateOne(ctx, bson.M{"id": users.ID}, &users, &options.UpdateOptions{Upsert: &[]bool{true}[0]})
+	var profile Profile
+	err := u.commit(ctx, logger, func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		if profile, err = u.repository.UpdateProfile(ctx, body.ID, update); err != nil {
+			return nil, err
+		}
+		return []events.Event{events.New(events.UserProfileUpdated, body.ID, events.ProfileUpdated{
+			ID:        body.ID,
+			Fields:    body.fields(),
+			UpdatedAt: time.Now().UTC(),
+		})}, nil
+	})
 	if err != nil {
 		logger.Error(err.Error())
-		session.AbortTransaction(ctx)
 		return nil, err
 	}
+	logger.Info("Update profile success", "id", profile.ID)
 
-	if body.ProfileImage != "" {
-		profileEN.Attachments = append(profileEN.Attachments, Attachment{
-			ID:   uuid.New().String(),
-			Name: "profileImage",
-			URL:  body.ProfileImage,
-			Type: "image",
-		})
-	}
-
-	profileTH.LanguageCode = "th"
-	profileLanguage = append(profileLanguage, *profileTH)
-	profileLanguage = append(profileLanguage, *profileEN)
-	if len(profileLanguage) > 0 {
-		for _, lang := range profileLanguage {
-			result, err := dbProfile.UpdateOne(ctx, bson.M{"id": lang.ID}, &lang, &options.UpdateOptions{Upsert: &[]bool{true}[0]})
-			if err != nil {
-				logger.Error(err.Error())
-				session.AbortTransaction(ctx)
-				return nil, err
-			}
-			logger.Info("Update profile language success", "id", result.UpsertedID)
-		}
-	}
-
-	session.CommitTransaction(ctx)
-
-	return updateResult, nil
+	return profile, nil
 }
 
 // func (u *userService) DeleteUser() {}
 
 // func (u *userService) AddRole() {}
 
-func (u *userService) generateAccessToken(user User) (string, error) {
-	private := os.Getenv("PRIVATE_ACCESS_KEY")
-	if private == "" {
-		return "", errors.New("private key not found")
-	}
-	privateKey, err := base64.StdEncoding.DecodeString(private)
-	if err != nil {
-		return "", err
-	}
-	rsa, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+type tokenRequest struct {
+	issuer     string
+	audience   jwt.ClaimStrings
+	format     string
+	clientID   string
+	rememberMe bool
+	authTime   time.Time
+	issuedAt   time.Time
+	expiry     tokenExpiry
+}
+
+func (u *userService) generateAccessToken(ctx context.Context, user User, request tokenRequest) (string, error) {
+	signer, err := u.keys.Signer(keys.Access)
 	if err != nil {
 		return "", err
 	}
@@ -380,11 +516,13 @@ func (u *userService) generateAccessToken(user User) (string, error) {
 	claims := &RegisteredClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   user.ID,
-			Issuer:    os.Getenv("ISSUER"),
-			Audience:  jwt.ClaimStrings{},
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 5)),
+			Issuer:    request.issuer,
+			Audience:  request.audience,
+			IssuedAt:  jwt.NewNumericDate(request.issuedAt),
+			ExpiresAt: jwt.NewNumericDate(request.expiry.access),
 		},
+		ClientID: request.clientID,
+		AuthTime: jwt.NewNumericDate(request.authTime),
 	}
 
 	if user.Email != "" {
@@ -395,20 +533,16 @@ func (u *userService) generateAccessToken(user User) (string, error) {
 		claims.UserName = user.Username
 	}
 
-	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(rsa)
-}
-
-func (u *userService) generateRefreshToken(user User) (string, error) {
-	private := os.Getenv("PRIVATE_REFRESH_KEY")
-	if private == "" {
-		return "", errors.New("private key not found")
-	}
-
-	privateKey, err := base64.StdEncoding.DecodeString(private)
+	token, err := signToken(ctx, signer, request.format, claims)
 	if err != nil {
 		return "", err
 	}
-	rsa, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+	metrics.TokenIssued(string(keys.Access), request.format)
+	return token, nil
+}
+
+func (u *userService) generateRefreshToken(ctx context.Context, user User, request tokenRequest) (string, error) {
+	signer, err := u.keys.Signer(keys.Refresh)
 	if err != nil {
 		return "", err
 	}
@@ -416,11 +550,14 @@ func (u *userService) generateRefreshToken(user User) (string, error) {
 	claims := &RegisteredClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   user.ID,
-			Issuer:    os.Getenv("ISSUER"),
-			Audience:  jwt.ClaimStrings{},
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 60)),
+			Issuer:    request.issuer,
+			Audience:  request.audience,
+			IssuedAt:  jwt.NewNumericDate(request.issuedAt),
+			ExpiresAt: jwt.NewNumericDate(request.expiry.refresh),
 		},
+		ClientID:   request.clientID,
+		AuthTime:   jwt.NewNumericDate(request.authTime),
+		RememberMe: request.rememberMe,
 	}
 
 	if user.Email != "" {
@@ -431,10 +568,16 @@ func (u *userService) generateRefreshToken(user User) (string, error) {
 		claims.UserName = user.Username
 	}
 
-	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(rsa)
+	token, err := signToken(ctx, signer, request.format, claims)
+	if err != nil {
+		return "", err
+	}
+	metrics.TokenIssued(string(keys.Refresh), request.format)
+	return token, nil
 }
 
 func (u *userService) hashPassword(password string) (string, error) {
+	defer metrics.ObserveBcrypt("hash", time.Now())
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
@@ -443,5 +586,6 @@ func (u *userService) hashPassword(password string) (string, error) {
 }
 
 func (u *userService) comparePassword(hashed, password string) error {
+	defer metrics.ObserveBcrypt("compare", time.Now())
 	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
 }
@@ -0,0 +1,56 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sing3demons/auth-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracedUserService struct {
+	next   UserService
+	tracer trace.Tracer
+}
+
+// NewTracedUserService wraps every call to next in a span. VerifyAccessToken
+// takes no context, so its spans start a new trace.
+func NewTracedUserService(next UserService) UserService {
+	return &tracedUserService{next, tracing.Tracer("user")}
+}
+
+func (s *tracedUserService) CreateUser(ctx context.Context, logger *slog.Logger, body User) (user User, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.CreateUser")
+	defer func() { tracing.End(span, err) }()
+	user, err = s.next.CreateUser(ctx, logger, body)
+	span.SetAttributes(attribute.String("user.id", user.ID))
+	return user, err
+}
+
+func (s *tracedUserService) GetUser(ctx context.Context, logger *slog.Logger, id string) (user User, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.GetUser", trace.WithAttributes(attribute.String("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	return s.next.GetUser(ctx, logger, id)
+}
+
+func (s *tracedUserService) Login(ctx context.Context, logger *slog.Logger, body Login) (token *TokenResponse, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Login", trace.WithAttributes(
+		attribute.String("auth.client_id", body.ClientID),
+		attribute.String("auth.audience", body.Audience),
+	))
+	defer func() { tracing.End(span, err) }()
+	return s.next.Login(ctx, logger, body)
+}
+
+func (s *tracedUserService) RefreshToken(ctx context.Context, logger *slog.Logger, token string) (response *TokenResponse, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.RefreshToken")
+	defer func() { tracing.End(span, err) }()
+	return s.next.RefreshToken(ctx, logger, token)
+}
+
+func (s *tracedUserService) VerifyAccessToken(logger *slog.Logger, token string) (response *TokenResponse, err error) {
+	_, span := s.tracer.Start(context.Background(), "UserService.VerifyAccessToken")
+	defer func() { tracing.End(span, err) }()
+	return s.next.VerifyAccessToken(logger, token)
+}
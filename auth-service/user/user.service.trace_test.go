@@ -0,0 +1,45 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/sing3demons/auth-service/tracing"
+	"github.com/sing3demons/auth-service/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedUserService(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(exporter, tracing.Config{})
+	otel.SetTracerProvider(provider)
+
+	mockUserService := new(user.MockUserService)
+	mockUserService.On("GetUser", mock.Anything, mock.Anything, "1").Return(user.User{ID: "1"}, nil)
+	mockUserService.On("Login", mock.Anything, mock.Anything, mock.Anything).Return((*user.TokenResponse)(nil), errors.New("user not found"))
+
+	service := user.NewTracedUserService(mockUserService)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	_, err := service.GetUser(ctx, slog.Default(), "1")
+	assert.NoError(t, err)
+	_, err = service.Login(ctx, slog.Default(), user.Login{ClientID: "mobile"})
+	assert.Error(t, err)
+	parent.End()
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	assert.Equal(t, parent.SpanContext().SpanID(), spans["UserService.GetUser"].Parent.SpanID())
+	assert.Equal(t, codes.Unset, spans["UserService.GetUser"].Status.Code)
+	assert.Equal(t, codes.Error, spans["UserService.Login"].Status.Code)
+	assert.Equal(t, "user not found", spans["UserService.Login"].Status.Description)
+	mockUserService.AssertExpectations(t)
+}
@@ -3,6 +3,7 @@ package user_test
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -12,6 +13,9 @@ import (
 	"log/slog"
 
 	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/auth-service/audit"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/outbox"
 	"github.com/sing3demons/auth-service/redis"
 	"github.com/sing3demons/auth-service/store"
 	"github.com/sing3demons/auth-service/user"
@@ -19,6 +23,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const PUBLIC_ACCESS_KEY = "LS0tLS1CRUdJTiBQVUJMSUMgS0VZLS0tLS0KTUlJQ0lUQU5CZ2txaGtpRzl3MEJBUUVGQUFPQ0FnNEFNSUlDQ1FLQ0FnQjFOUE1pWmxSSjVIMk00cmV1aGFiQgpXaDliZU1VQi8vWXBPNmVoSmtiTzd2ZTdyTWh0ZC9xRHFXSWd6cGdtNm0yL0lMTUJCck5CbzZWUnhqVUtHSTBMCk1PVk81a09pejZWc3BBRDd6RlFNOXRSbXZVOWdrRE85U0dsdHhxaHZxS3FTdHYzNWZ3blJzNlhERGJTLzVLMFgKdWZBeWY3NlBUQkZ6NnBRZnROU1lhRURGeVkrM2s2eGlDTlB5Vkw1Y05LeWlPQzVBNllMb3FWZHhHV2RGYkFVVAo2Z3pseldhNXhHUm9ZZXZnaFA4N01yMDNSNTdlRVk5bnV3cXpMc2lpWWxUd0JIOGMvNXQxdWFyZlNEMnBFajZyCmlzUytMSGkzc0h3RFRnRFE4UEt5ZEt3bytmNzhNN2s0VDR3bld6Nlp0ZC84UFFYZ1d6dm9pWk5BZzhJbnBpRTUKUmlYT3dMcHlraS9YYUUvNlFzTkM1TjhYZVVIUDRta0UvUjFuSHFRaTBVNXpKbzVFUnhQRzNVeHkyYVI3US9ZZgptZHNlUUt5WEtETHIxSUk0Z25DcjNlQmxGLzJrT2Z2NWszZXVxMS92c1l2S1k2NThEb0U4TFBBK2t5QkhFQTVRCkp4RkkxZlVWSTVwWmtzdnJPeVFGUURqSjFXN2Y3UG5EOTB5WnpWSnIrYWxhMGV5eWdDcjNoSGpjZGNvZEpXQkEKL3dCUzhQbGxEclBmbWdUWkRQTHZLcWNTcGh3WGRXZG92aEpFZk44L3dBQUxJNmlBQWgzVnJORmJ3NkZZdHVvTgppcEMwYStNczVlVnMzL1duU3ZtRy8zTFRSZkh0VXRYRDZZMkNxV3pjRi9GeHZCV2lwVlB6YlAxblllM0pObU53CkdHQ2JpR3ZJUkNiQWhXSjFQRVRKWVFJREFRQUIKLS0tLS1FTkQgUFVCTElDIEtFWS0tLS0t"
@@ -957,3 +962,180 @@ func TestCreateUser(t *testing.T) {
 
 	})
 }
+
+func TestCreateUserMemoryStore(t *testing.T) {
+	ctx := context.TODO()
+	mockLogger := slog.Default()
+	service := user.NewUserService(store.NewMemoryStore(), new(redis.MockRedis))
+
+	created, err := service.CreateUser(ctx, mockLogger, user.User{
+		Email:    mockEmail,
+		Username: mockUserName,
+		Password: mockPassword,
+	})
+	assert.NoError(t, err)
+
+	_, err = service.CreateUser(ctx, mockLogger, user.User{
+		Email:    mockEmail,
+		Password: mockPassword,
+	})
+	assert.EqualError(t, err, "email already exists")
+
+	result, err := service.GetUser(ctx, mockLogger, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mockEmail, result.Email)
+	assert.Equal(t, []string{"user"}, result.Roles)
+}
+
+// webClientConfig is the default token configuration with a "web" client.
+func webClientConfig() user.TokenConfig {
+	config := user.DefaultTokenConfig()
+	config.Clients = map[string]user.Lifetimes{"web": {}}
+	return config
+}
+
+func TestLoginAudit(t *testing.T) {
+	ctx := audit.WithSource(context.TODO(), audit.Source{IP: "10.0.0.1"})
+	logger := slog.Default()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(mockPassword), bcrypt.MinCost)
+	assert.NoError(t, err)
+	repository := user.NewMockUserRepository()
+	repository.On("FindByEmail", ctx, mockEmail).Return(user.User{ID: subject, Email: mockEmail, Password: string(hashed)}, nil)
+	repository.On("FindByEmail", ctx, "nobody@test.com").Return(user.User{}, user.ErrUserNotFound)
+	repository.On("FindByID", ctx, subject).Return(user.User{ID: subject, Email: mockEmail}, nil)
+
+	cache := redis.NewMemory()
+	defer cache.Close()
+	log := audit.NewLog(store.NewMemoryStore(), audit.Config{})
+	service := user.NewUserServiceWithConfig(repository, cache, newEdDSAKeyring(t), user.Config{Tokens: user.NewTokens(webClientConfig()), Audit: log})
+
+	_, err = service.Login(ctx, logger, user.Login{Email: "nobody@test.com", Password: mockPassword})
+	assert.Error(t, err)
+	_, err = service.Login(ctx, logger, user.Login{Email: mockEmail, Password: "wrong"})
+	assert.Error(t, err)
+	token, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, ClientID: "web"})
+	assert.NoError(t, err)
+	_, err = service.RefreshToken(ctx, logger, token.RefreshToken)
+	assert.NoError(t, err)
+
+	records, err := log.Find(ctx, audit.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, []audit.EventType{audit.LoginFailed, audit.LoginFailed, audit.LoginSucceeded, audit.TokenRefreshed},
+		[]audit.EventType{records[0].Type, records[1].Type, records[2].Type, records[3].Type})
+	assert.Equal(t, "user_not_found", records[0].Reason)
+	assert.Equal(t, "nobody@test.com", records[0].Details["identifier"])
+	assert.Equal(t, "invalid_password", records[1].Reason)
+	assert.Equal(t, subject, records[1].ActorID)
+	assert.Equal(t, "web", records[2].Details["client_id"])
+	assert.Equal(t, "10.0.0.1", records[3].IP)
+
+	report, err := log.Verify(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, report.Problem)
+}
+
+func TestUserEvents(t *testing.T) {
+	ctx := context.TODO()
+	logger := slog.Default()
+
+	db := store.NewMemoryStore()
+	repository := user.NewMongoUserRepository(db)
+	cache := redis.NewMemory()
+	defer cache.Close()
+	publisher := events.NewMemory()
+	service := user.NewUserServiceWithConfig(repository, cache, newEdDSAKeyring(t), user.Config{Tokens: user.NewTokens(webClientConfig()), Events: publisher})
+
+	created, err := service.CreateUser(ctx, logger, user.User{Email: mockEmail, Username: mockUserName, Password: mockPassword})
+	assert.NoError(t, err)
+	_, err = service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, ClientID: "web"})
+	assert.NoError(t, err)
+
+	// a failed publish does not fail the login
+	publisher.Fail(errors.New("broker down"))
+	_, err = service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword})
+	assert.NoError(t, err)
+
+	published := publisher.Events()
+	assert.Len(t, published, 2)
+	assert.Equal(t, events.UserRegistered, published[0].Type)
+	assert.Equal(t, created.ID, published[0].Subject)
+	assert.Equal(t, mockEmail, published[0].Data.(events.Registered).Email)
+	assert.Equal(t, events.UserLoggedIn, published[1].Type)
+	assert.Equal(t, events.LoggedIn{ID: created.ID, ClientID: "web"}, published[1].Data)
+}
+
+// hangingPublisher stands in for an unreachable broker.
+type hangingPublisher struct{}
+
+func (hangingPublisher) Publish(ctx context.Context, evts ...events.Event) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (hangingPublisher) Close() error {
+	return nil
+}
+
+func TestUserEventsPublishTimeout(t *testing.T) {
+	ctx := context.TODO()
+	logger := slog.Default()
+
+	cache := redis.NewMemory()
+	defer cache.Close()
+	service := user.NewUserServiceWithConfig(user.NewMongoUserRepository(store.NewMemoryStore()), cache, newEdDSAKeyring(t), user.Config{
+		Tokens:         user.NewTokens(webClientConfig()),
+		Events:         hangingPublisher{},
+		PublishTimeout: 50 * time.Millisecond,
+	})
+
+	start := time.Now()
+	_, err := service.CreateUser(ctx, logger, user.User{Email: mockEmail, Username: mockUserName, Password: mockPassword})
+	assert.NoError(t, err)
+	_, err = service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, ClientID: "web"})
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// failingOutbox stores nothing, so the write it shares a transaction with
+// must roll back.
+type failingOutbox struct {
+	*outbox.Outbox
+}
+
+func (failingOutbox) Publish(ctx context.Context, evts ...events.Event) error {
+	return errors.New("outbox full")
+}
+
+func TestUserEventsOutbox(t *testing.T) {
+	ctx := context.TODO()
+	logger := slog.Default()
+
+	db := store.NewMemoryStore()
+	repository := user.NewMongoUserRepository(db)
+	cache := redis.NewMemory()
+	defer cache.Close()
+	box := outbox.New(db, outbox.Config{})
+	tokens := user.NewTokens(user.DefaultTokenConfig())
+	keyring := newEdDSAKeyring(t)
+
+	failing := user.NewUserServiceWithConfig(repository, cache, keyring, user.Config{Tokens: tokens, Events: failingOutbox{box}})
+	_, err := failing.CreateUser(ctx, logger, user.User{Email: mockEmail, Username: mockUserName, Password: mockPassword})
+	assert.EqualError(t, err, "outbox full")
+	_, err = failing.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword})
+	assert.Error(t, err, "the user is not stored without its event")
+
+	service := user.NewUserServiceWithConfig(repository, cache, keyring, user.Config{Tokens: tokens, Events: box})
+	created, err := service.CreateUser(ctx, logger, user.User{Email: mockEmail, Username: mockUserName, Password: mockPassword})
+	assert.NoError(t, err)
+
+	sink := events.NewMemory()
+	delivered, err := outbox.NewRelay(box, sink, outbox.RelayConfig{}, logger).RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	published := sink.Events()
+	assert.Equal(t, events.UserRegistered, published[0].Type)
+	assert.Equal(t, created.ID, published[0].Subject)
+	assert.Contains(t, string(published[0].Data.(json.RawMessage)), mockEmail)
+}
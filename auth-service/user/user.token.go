@@ -0,0 +1,358 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/auth-service/keys"
+)
+
+const (
+	TokenFormatJWT    = "jwt"
+	TokenFormatPaseto = "paseto"
+)
+
+var (
+	ErrTokenFormat    = errors.New("unsupported token format")
+	ErrSessionExpired = errors.New("session expired")
+	ErrAudience       = errors.New("audience not allowed")
+	ErrUnknownClient  = errors.New("unknown client")
+)
+
+// TokenConfig chooses the format and lifetimes of issued tokens.
+//
+// A format requested at login wins, then the format configured for the
+// requested audience, then Format. PASETO tokens are v4.public and need
+// EdDSA keys.
+//
+// A login may only ask for an audience listed in Audiences or
+// AudienceFormats.
+//
+// Lifetimes apply to every client; Clients overrides them per client_id.
+// Zero fields fall back to the global value, then to DefaultLifetimes. A
+// login may only name a client_id listed in Clients.
+type TokenConfig struct {
+	Issuer          string               `yaml:"issuer"`
+	Format          string               `yaml:"format"`
+	AudienceFormats map[string]string    `yaml:"audience_formats"`
+	Audiences       []string             `yaml:"audiences"`
+	Lifetimes       Lifetimes            `yaml:"lifetimes"`
+	Clients         map[string]Lifetimes `yaml:"clients"`
+}
+
+// Lifetimes bound a login session. Access and Refresh are the token
+// lifetimes; a remember-me login gets RememberMe instead of Refresh and is
+// exempt from Idle. Idle is how long a refresh token stays usable without
+// being exchanged. MaxSession caps every token at that long after the
+// original login. Zero Idle or MaxSession disables the limit.
+type Lifetimes struct {
+	Access     time.Duration `yaml:"access"`
+	Refresh    time.Duration `yaml:"refresh"`
+	RememberMe time.Duration `yaml:"remember_me"`
+	Idle       time.Duration `yaml:"idle"`
+	MaxSession time.Duration `yaml:"max_session"`
+}
+
+func DefaultLifetimes() Lifetimes {
+	return Lifetimes{
+		Access:     5 * time.Minute,
+		Refresh:    60 * time.Minute,
+		RememberMe: 30 * 24 * time.Hour,
+	}
+}
+
+func DefaultTokenConfig() TokenConfig {
+	return TokenConfig{Format: TokenFormatJWT, Lifetimes: DefaultLifetimes()}
+}
+
+// Tokens holds the TokenConfig in use. Store swaps it atomically, so a
+// configuration reload applies from the next login or refresh on.
+type Tokens struct {
+	config atomic.Pointer[TokenConfig]
+}
+
+func NewTokens(config TokenConfig) *Tokens {
+	t := &Tokens{}
+	t.Store(config)
+	return t
+}
+
+func (t *Tokens) Load() TokenConfig {
+	return *t.config.Load()
+}
+
+func (t *Tokens) Store(config TokenConfig) {
+	t.config.Store(&config)
+}
+
+func (c TokenConfig) Validate() error {
+	if err := validateTokenFormat(c.Format); err != nil {
+		return err
+	}
+	for _, format := range c.AudienceFormats {
+		if err := validateTokenFormat(format); err != nil {
+			return err
+		}
+	}
+	if err := c.Lifetimes.validate(); err != nil {
+		return err
+	}
+	for client, lifetimes := range c.Clients {
+		if err := lifetimes.validate(); err != nil {
+			return fmt.Errorf("client %s: %w", client, err)
+		}
+	}
+	return nil
+}
+
+func (l Lifetimes) validate() error {
+	for _, d := range []time.Duration{l.Access, l.Refresh, l.RememberMe, l.Idle, l.MaxSession} {
+		if d < 0 {
+			return fmt.Errorf("negative token lifetime %s", d)
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON reads lifetimes as duration strings keyed access, refresh,
+// remember_me, idle and max_session.
+func (l *Lifetimes) UnmarshalJSON(data []byte) error {
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	fields := map[string]*time.Duration{
+		"access":      &l.Access,
+		"refresh":     &l.Refresh,
+		"remember_me": &l.RememberMe,
+		"idle":        &l.Idle,
+		"max_session": &l.MaxSession,
+	}
+	for key, value := range raw {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown token lifetime %q", key)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*field = d
+	}
+	return nil
+}
+
+// or returns l with its zero fields taken from fallback.
+func (l Lifetimes) or(fallback Lifetimes) Lifetimes {
+	pick := func(d, fallback time.Duration) time.Duration {
+		if d == 0 {
+			return fallback
+		}
+		return d
+	}
+	return Lifetimes{
+		Access:     pick(l.Access, fallback.Access),
+		Refresh:    pick(l.Refresh, fallback.Refresh),
+		RememberMe: pick(l.RememberMe, fallback.RememberMe),
+		Idle:       pick(l.Idle, fallback.Idle),
+		MaxSession: pick(l.MaxSession, fallback.MaxSession),
+	}
+}
+
+func (c TokenConfig) lifetimes(clientID string) Lifetimes {
+	return c.Clients[clientID].or(c.Lifetimes.or(DefaultLifetimes()))
+}
+
+type tokenExpiry struct {
+	access  time.Time
+	refresh time.Time
+	// refreshTTL is how long the refresh token is kept in Redis; it is
+	// shorter than the token itself when an idle timeout applies.
+	refreshTTL time.Duration
+}
+
+func (c TokenConfig) expiry(request tokenRequest) tokenExpiry {
+	lifetimes := c.lifetimes(request.clientID)
+
+	refreshLifetime := lifetimes.Refresh
+	if request.rememberMe {
+		refreshLifetime = lifetimes.RememberMe
+	}
+	expiry := tokenExpiry{
+		access:  request.issuedAt.Add(lifetimes.Access),
+		refresh: request.issuedAt.Add(refreshLifetime),
+	}
+	if lifetimes.MaxSession > 0 {
+		end := request.authTime.Add(lifetimes.MaxSession)
+		if expiry.access.After(end) {
+			expiry.access = end
+		}
+		if expiry.refresh.After(end) {
+			expiry.refresh = end
+		}
+	}
+
+	expiry.refreshTTL = expiry.refresh.Sub(request.issuedAt)
+	if lifetimes.Idle > 0 && !request.rememberMe && lifetimes.Idle < expiry.refreshTTL {
+		expiry.refreshTTL = lifetimes.Idle
+	}
+	return expiry
+}
+
+func validateTokenFormat(format string) error {
+	if format != TokenFormatJWT && format != TokenFormatPaseto {
+		return fmt.Errorf("%w: %q", ErrTokenFormat, format)
+	}
+	return nil
+}
+
+func (c TokenConfig) format(requested, audience string) (string, error) {
+	if requested != "" {
+		return requested, validateTokenFormat(requested)
+	}
+	if format, ok := c.AudienceFormats[audience]; ok {
+		return format, nil
+	}
+	if c.Format == "" {
+		return TokenFormatJWT, nil
+	}
+	return c.Format, nil
+}
+
+// audience checks that a login may ask for audience. No audience is always
+// allowed.
+func (c TokenConfig) audience(audience string) error {
+	if audience == "" || slices.Contains(c.Audiences, audience) {
+		return nil
+	}
+	if _, ok := c.AudienceFormats[audience]; ok {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrAudience, audience)
+}
+
+// client checks that a login may name clientID. No client is always
+// allowed and gets the global lifetimes.
+func (c TokenConfig) client(clientID string) error {
+	if _, ok := c.Clients[clientID]; clientID != "" && !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownClient, clientID)
+	}
+	return nil
+}
+
+func tokenFormat(token string) string {
+	if keys.IsPaseto(token) {
+		return TokenFormatPaseto
+	}
+	return TokenFormatJWT
+}
+
+// pasetoClaims is RegisteredClaims as a PASETO payload, whose registered
+// claims use RFC 3339 timestamps and a single audience string.
+type pasetoClaims struct {
+	Issuer     string     `json:"iss,omitempty"`
+	Subject    string     `json:"sub,omitempty"`
+	Audience   string     `json:"aud,omitempty"`
+	ExpiresAt  *time.Time `json:"exp,omitempty"`
+	NotBefore  *time.Time `json:"nbf,omitempty"`
+	IssuedAt   *time.Time `json:"iat,omitempty"`
+	ID         string     `json:"jti,omitempty"`
+	UserName   string     `json:"username,omitempty"`
+	Email      string     `json:"email,omitempty"`
+	ClientID   string     `json:"client_id,omitempty"`
+	AuthTime   *time.Time `json:"auth_time,omitempty"`
+	RememberMe bool       `json:"remember_me,omitempty"`
+}
+
+func pasetoTime(date *jwt.NumericDate) *time.Time {
+	if date == nil {
+		return nil
+	}
+	t := date.Time.UTC()
+	return &t
+}
+
+func numericDate(t *time.Time) *jwt.NumericDate {
+	if t == nil {
+		return nil
+	}
+	return jwt.NewNumericDate(*t)
+}
+
+func signToken(ctx context.Context, signer keys.Signer, format string, claims *RegisteredClaims) (string, error) {
+	if format != TokenFormatPaseto {
+		return keys.SignToken(ctx, signer, claims)
+	}
+
+	payload := pasetoClaims{
+		Issuer:     claims.Issuer,
+		Subject:    claims.Subject,
+		ExpiresAt:  pasetoTime(claims.ExpiresAt),
+		NotBefore:  pasetoTime(claims.NotBefore),
+		IssuedAt:   pasetoTime(claims.IssuedAt),
+		ID:         claims.ID,
+		UserName:   claims.UserName,
+		Email:      claims.Email,
+		ClientID:   claims.ClientID,
+		AuthTime:   pasetoTime(claims.AuthTime),
+		RememberMe: claims.RememberMe,
+	}
+	if len(claims.Audience) > 0 {
+		payload.Audience = claims.Audience[0]
+	}
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return keys.SignPaseto(ctx, signer, message)
+}
+
+// parseToken verifies a JWT or PASETO token against key and validates its
+// time claims.
+func parseToken(key keys.Key, token string) (*RegisteredClaims, error) {
+	if !keys.IsPaseto(token) {
+		claims := &RegisteredClaims{}
+		if _, err := key.Parse(token, claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
+	message, err := key.ParsePaseto(token)
+	if err != nil {
+		return nil, err
+	}
+	var payload pasetoClaims
+	if err := json.Unmarshal(message, &payload); err != nil {
+		return nil, err
+	}
+
+	claims := &RegisteredClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    payload.Issuer,
+			Subject:   payload.Subject,
+			ExpiresAt: numericDate(payload.ExpiresAt),
+			NotBefore: numericDate(payload.NotBefore),
+			IssuedAt:  numericDate(payload.IssuedAt),
+			ID:        payload.ID,
+		},
+		UserName:   payload.UserName,
+		Email:      payload.Email,
+		ClientID:   payload.ClientID,
+		AuthTime:   numericDate(payload.AuthTime),
+		RememberMe: payload.RememberMe,
+	}
+	if payload.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{payload.Audience}
+	}
+	if err := jwt.NewValidator().Validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
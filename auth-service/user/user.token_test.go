@@ -0,0 +1,233 @@
+package user_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/auth-service/keys"
+	"github.com/sing3demons/auth-service/redis"
+	"github.com/sing3demons/auth-service/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newEdDSAKeyring(t *testing.T) keys.Keyring {
+	ctx := context.TODO()
+	kms := keys.NewFakeKMS()
+	assert.NoError(t, kms.CreateKey("access-1", keys.EdDSA))
+	assert.NoError(t, kms.CreateKey("refresh-1", keys.EdDSA))
+
+	access, err := keys.NewKMSSigner(ctx, kms, "access-1", keys.EdDSA)
+	assert.NoError(t, err)
+	refresh, err := keys.NewKMSSigner(ctx, kms, "refresh-1", keys.EdDSA)
+	assert.NoError(t, err)
+	return keys.NewSignerKeyring(access, refresh)
+}
+
+func TestTokenFormat(t *testing.T) {
+	ctx := context.TODO()
+	logger := slog.Default()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(mockPassword), bcrypt.MinCost)
+	assert.NoError(t, err)
+	repository := user.NewMockUserRepository()
+	repository.On("FindByEmail", ctx, mockEmail).Return(user.User{ID: subject, Email: mockEmail, Password: string(hashed)}, nil)
+	repository.On("FindByID", ctx, subject).Return(user.User{ID: subject, Email: mockEmail}, nil)
+
+	cache := redis.NewMemory()
+	defer cache.Close()
+
+	service := user.NewUserServiceWithConfig(repository, cache, newEdDSAKeyring(t), user.Config{Tokens: user.NewTokens(user.TokenConfig{
+		Format:          user.TokenFormatJWT,
+		AudienceFormats: map[string]string{"inventory": user.TokenFormatPaseto},
+		Audiences:       []string{"billing"},
+	})})
+
+	t.Run("requested format", func(t *testing.T) {
+		token, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, Format: user.TokenFormatPaseto})
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(token.AccessToken, "v4.public."))
+		assert.True(t, strings.HasPrefix(token.RefreshToken, "v4.public."))
+
+		_, err = service.VerifyAccessToken(logger, token.AccessToken)
+		assert.NoError(t, err)
+
+		refreshed, err := service.RefreshToken(ctx, logger, token.RefreshToken)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(refreshed.AccessToken, "v4.public."))
+
+		// an access token does not pass as a refresh token
+		_, err = service.RefreshToken(ctx, logger, refreshed.AccessToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("audience format", func(t *testing.T) {
+		token, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, Audience: "inventory"})
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(token.AccessToken, "v4.public."))
+
+		token, err = service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, Audience: "billing"})
+		assert.NoError(t, err)
+		assert.False(t, strings.HasPrefix(token.AccessToken, "v4.public."))
+		_, err = service.VerifyAccessToken(logger, token.AccessToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unknown audience", func(t *testing.T) {
+		_, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, Audience: "payroll"})
+		assert.ErrorIs(t, err, user.ErrAudience)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, Format: "saml"})
+		assert.ErrorIs(t, err, user.ErrTokenFormat)
+	})
+
+	t.Run("tampered token", func(t *testing.T) {
+		token, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, Format: user.TokenFormatPaseto})
+		assert.NoError(t, err)
+		_, err = service.VerifyAccessToken(logger, token.AccessToken[:len(token.AccessToken)-30]+strings.Repeat("A", 30))
+		assert.EqualError(t, err, user.ErrTokenInvalid)
+	})
+}
+
+func TestTokenConfigValidate(t *testing.T) {
+	config := user.DefaultTokenConfig()
+	assert.NoError(t, config.Validate())
+
+	config.AudienceFormats = map[string]string{"legacy": "saml"}
+	assert.ErrorIs(t, config.Validate(), user.ErrTokenFormat)
+
+	config = user.DefaultTokenConfig()
+	config.Clients = map[string]user.Lifetimes{"mobile": {Idle: -time.Minute}}
+	assert.Error(t, config.Validate())
+}
+
+func TestTokenLifetimes(t *testing.T) {
+	ctx := context.TODO()
+	logger := slog.Default()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(mockPassword), bcrypt.MinCost)
+	assert.NoError(t, err)
+	repository := user.NewMockUserRepository()
+	repository.On("FindByEmail", ctx, mockEmail).Return(user.User{ID: subject, Email: mockEmail, Password: string(hashed)}, nil)
+	repository.On("FindByID", ctx, subject).Return(user.User{ID: subject, Email: mockEmail}, nil)
+
+	keyring := newEdDSAKeyring(t)
+	config := user.TokenConfig{
+		Lifetimes: user.Lifetimes{Access: 10 * time.Minute, Idle: 30 * time.Minute},
+		Clients: map[string]user.Lifetimes{
+			"mobile": {Refresh: 24 * time.Hour, Idle: 12 * time.Hour, MaxSession: 7 * 24 * time.Hour},
+		},
+	}
+
+	expiresIn := func(t *testing.T, token string) time.Duration {
+		claims := &user.RegisteredClaims{}
+		_, _, err := jwt.NewParser().ParseUnverified(token, claims)
+		assert.NoError(t, err)
+		return time.Until(claims.ExpiresAt.Time).Round(time.Minute)
+	}
+
+	tests := []struct {
+		name    string
+		login   user.Login
+		access  time.Duration
+		refresh time.Duration
+		ttl     time.Duration
+	}{
+		{"global", user.Login{}, 10 * time.Minute, 60 * time.Minute, 30 * time.Minute},
+		{"remember me skips idle timeout", user.Login{RememberMe: true}, 10 * time.Minute, 30 * 24 * time.Hour, 30 * 24 * time.Hour},
+		{"client override", user.Login{ClientID: "mobile"}, 10 * time.Minute, 24 * time.Hour, 12 * time.Hour},
+		{"client session maximum", user.Login{ClientID: "mobile", RememberMe: true}, 10 * time.Minute, 7 * 24 * time.Hour, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRedis := new(redis.MockRedis)
+			mockRedis.On("SetEx", ctx, mock.Anything, "true", mock.MatchedBy(func(ttl time.Duration) bool {
+				return ttl.Round(time.Minute) == tt.ttl
+			})).Return(nil).Once()
+
+			service := user.NewUserServiceWithConfig(repository, mockRedis, keyring, user.Config{Tokens: user.NewTokens(config)})
+			tt.login.Email, tt.login.Password = mockEmail, mockPassword
+			token, err := service.Login(ctx, logger, tt.login)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.access, expiresIn(t, token.AccessToken))
+			assert.Equal(t, tt.refresh, expiresIn(t, token.RefreshToken))
+			mockRedis.AssertExpectations(t)
+		})
+	}
+
+	t.Run("unknown client", func(t *testing.T) {
+		service := user.NewUserServiceWithConfig(repository, new(redis.MockRedis), keyring, user.Config{Tokens: user.NewTokens(config)})
+		_, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, ClientID: "kiosk"})
+		assert.ErrorIs(t, err, user.ErrUnknownClient)
+	})
+
+	t.Run("refresh keeps the session", func(t *testing.T) {
+		cache := redis.NewMemory()
+		defer cache.Close()
+
+		service := user.NewUserServiceWithConfig(repository, cache, keyring, user.Config{Tokens: user.NewTokens(config)})
+		token, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword, ClientID: "mobile", RememberMe: true})
+		assert.NoError(t, err)
+
+		refreshed, err := service.RefreshToken(ctx, logger, token.RefreshToken)
+		assert.NoError(t, err)
+		claims := &user.RegisteredClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(refreshed.RefreshToken, claims)
+		assert.NoError(t, err)
+		assert.Equal(t, "mobile", claims.ClientID)
+		assert.True(t, claims.RememberMe)
+		assert.NotNil(t, claims.AuthTime)
+
+		// a tighter session maximum applies to sessions already issued
+		config := config
+		config.Lifetimes.MaxSession = time.Nanosecond
+		config.Clients = nil
+		strict := user.NewUserServiceWithConfig(repository, cache, keyring, user.Config{Tokens: user.NewTokens(config)})
+		_, err = strict.RefreshToken(ctx, logger, refreshed.RefreshToken)
+		assert.ErrorIs(t, err, user.ErrSessionExpired)
+	})
+}
+
+func TestTokensReload(t *testing.T) {
+	ctx := context.TODO()
+	logger := slog.Default()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(mockPassword), bcrypt.MinCost)
+	assert.NoError(t, err)
+	repository := user.NewMockUserRepository()
+	repository.On("FindByEmail", ctx, mockEmail).Return(user.User{ID: subject, Email: mockEmail, Password: string(hashed)}, nil)
+
+	cache := redis.NewMemory()
+	defer cache.Close()
+
+	tokens := user.NewTokens(user.DefaultTokenConfig())
+	service := user.NewUserServiceWithConfig(repository, cache, newEdDSAKeyring(t), user.Config{Tokens: tokens})
+	login := func() *user.RegisteredClaims {
+		token, err := service.Login(ctx, logger, user.Login{Email: mockEmail, Password: mockPassword})
+		assert.NoError(t, err)
+		claims := &user.RegisteredClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(token.AccessToken, claims)
+		assert.NoError(t, err)
+		return claims
+	}
+
+	claims := login()
+	assert.Equal(t, 5*time.Minute, time.Until(claims.ExpiresAt.Time).Round(time.Minute))
+	assert.Empty(t, claims.Issuer)
+
+	config := user.DefaultTokenConfig()
+	config.Issuer = "auth-service"
+	config.Lifetimes.Access = 15 * time.Minute
+	tokens.Store(config)
+
+	claims = login()
+	assert.Equal(t, 15*time.Minute, time.Until(claims.ExpiresAt.Time).Round(time.Minute))
+	assert.Equal(t, "auth-service", claims.Issuer)
+}
@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sing3demons/auth-service/mlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DispatcherConfig struct {
+	// Interval is how often queued deliveries are polled.
+	Interval  time.Duration `yaml:"interval"`
+	BatchSize int64         `yaml:"batch_size"`
+	// Timeout bounds each HTTP request.
+	Timeout time.Duration `yaml:"timeout"`
+	// Backoff doubles after every failed attempt up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// MaxAttempts is how many times a delivery is tried before it is
+	// dead-lettered.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Lease is how long a dispatcher owns a delivery it is sending, so
+	// dispatchers in other instances skip it.
+	Lease time.Duration `yaml:"lease"`
+}
+
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		Interval:    time.Second,
+		BatchSize:   100,
+		Timeout:     10 * time.Second,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  time.Hour,
+		MaxAttempts: 10,
+		Lease:       time.Minute,
+	}
+}
+
+// Dispatcher sends queued deliveries. A 2xx response delivers; anything
+// else is retried with exponential backoff until MaxAttempts.
+type Dispatcher struct {
+	manager *Manager
+	client  *http.Client
+	config  DispatcherConfig
+	logger  *slog.Logger
+}
+
+// NewDispatcher sends with client, or with a client that forwards request
+// IDs when client is nil.
+func NewDispatcher(manager *Manager, client *http.Client, config DispatcherConfig, logger *slog.Logger) *Dispatcher {
+	defaults := DefaultDispatcherConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaults.Backoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.Lease <= config.Timeout {
+		config.Lease = max(defaults.Lease, 2*config.Timeout)
+	}
+	if client == nil {
+		client = &http.Client{Transport: mlog.NewTransport(nil)}
+	}
+	return &Dispatcher{manager: manager, client: client, config: config, logger: logger}
+}
+
+// Run dispatches every Interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DispatchOnce(ctx); err != nil {
+			d.logger.Error("webhook dispatch failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due deliveries and returns how many were
+// delivered. Failed sends are scheduled for retry, not returned as errors.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	now := d.manager.now()
+	cursor, err := d.manager.deliveries().Find(ctx,
+		bson.M{"status": StatusPending, "next_attempt": bson.M{"$lte": now}},
+		options.Find().SetSort(bson.D{{Key: "next_attempt", Value: 1}}).SetLimit(d.config.BatchSize))
+	if err != nil {
+		return 0, fmt.Errorf("webhook: %w", err)
+	}
+	var due []Delivery
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, fmt.Errorf("webhook: %w", err)
+	}
+
+	delivered := 0
+	for _, delivery := range due {
+		ok, err := d.dispatch(ctx, delivery)
+		if err != nil {
+			return delivered, err
+		}
+		if ok {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// dispatch reports whether delivery was delivered. It returns an error only
+// when the delivery itself cannot be updated.
+func (d *Dispatcher) dispatch(ctx context.Context, delivery Delivery) (bool, error) {
+	now := d.manager.now()
+
+	// take the lease; another dispatcher holding it wins
+	claimed, err := d.manager.deliveries().UpdateOne(ctx,
+		bson.M{"_id": delivery.ID, "status": StatusPending, "lease_until": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"lease_until": now.Add(d.config.Lease)}})
+	if err != nil {
+		return false, fmt.Errorf("webhook: %w", err)
+	}
+	if claimed.MatchedCount == 0 {
+		return false, nil
+	}
+
+	sub, err := d.manager.Subscription(ctx, delivery.SubscriptionID)
+	if errors.Is(err, ErrNotFound) {
+		return false, d.fail(ctx, delivery, 0, errors.New("subscription deleted"), true)
+	}
+	if err != nil {
+		return false, err
+	}
+	if !sub.Active {
+		return false, d.fail(ctx, delivery, 0, errors.New("subscription inactive"), true)
+	}
+
+	status, sendErr := d.send(ctx, sub, delivery)
+	if sendErr != nil {
+		delivery.Attempts++
+		return false, d.fail(ctx, delivery, status, sendErr, delivery.Attempts >= d.config.MaxAttempts)
+	}
+
+	_, err = d.manager.deliveries().UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": bson.M{
+		"status":       StatusDelivered,
+		"attempts":     delivery.Attempts + 1,
+		"last_status":  status,
+		"last_error":   "",
+		"delivered_at": d.manager.now().UTC(),
+		"lease_until":  time.Time{},
+	}})
+	if err != nil {
+		return false, fmt.Errorf("webhook: %w", err)
+	}
+	return true, nil
+}
+
+// send posts the delivery, signed at the time of sending, and returns the
+// response status.
+func (d *Dispatcher) send(ctx context.Context, sub Subscription, delivery Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	body := []byte(delivery.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", delivery.ContentType)
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderEvent, string(delivery.EventType))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, d.manager.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// fail records a failed attempt and schedules the next one, or moves the
+// delivery to the dead-letter list.
+func (d *Dispatcher) fail(ctx context.Context, delivery Delivery, status int, cause error, dead bool) error {
+	set := bson.M{
+		"attempts":    delivery.Attempts,
+		"last_status": status,
+		"last_error":  cause.Error(),
+		"lease_until": time.Time{},
+	}
+	if dead {
+		set["status"] = StatusDead
+		d.logger.Warn("webhook delivery dead-lettered", "id", delivery.ID, "subscription", delivery.SubscriptionID,
+			"type", delivery.EventType, "attempts", delivery.Attempts, "error", cause)
+	} else {
+		backoff := d.config.Backoff << min(delivery.Attempts-1, 20)
+		if backoff > d.config.MaxBackoff || backoff <= 0 {
+			backoff = d.config.MaxBackoff
+		}
+		set["next_attempt"] = d.manager.now().Add(backoff)
+		d.logger.Warn("webhook delivery failed", "id", delivery.ID, "subscription", delivery.SubscriptionID,
+			"type", delivery.EventType, "attempts", delivery.Attempts, "retry_in", backoff.String(), "error", cause)
+	}
+	if _, err := d.manager.deliveries().UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+// Package webhook delivers user events to partner endpoints over HTTP.
+// Subscriptions choose which event types they receive; each matching event
+// becomes a Delivery that a Dispatcher sends, signs and retries until it
+// succeeds or is dead-lettered.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultDatabase               = "auth"
+	DefaultSubscriptionCollection = "webhook_subscriptions"
+	DefaultDeliveryCollection     = "webhook_deliveries"
+
+	// HeaderID carries the delivery ID and HeaderEventID the event ID.
+	// Both stay the same across retries, replays and repeated publishes of
+	// one event, so receivers can drop duplicates by either.
+	HeaderID        = "X-Webhook-Id"
+	HeaderEventID   = "X-Webhook-Event-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderSignature = "X-Webhook-Signature"
+
+	maxQueryLimit = 1000
+)
+
+// Delivery statuses. A dead delivery ran out of attempts and waits for a
+// replay.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+var (
+	ErrInvalid       = errors.New("webhook: invalid subscription")
+	ErrNotFound      = errors.New("webhook: not found")
+	ErrNotReplayable = errors.New("webhook: only failed deliveries can be replayed")
+)
+
+type Config struct {
+	Database      string
+	Subscriptions string
+	Deliveries    string
+	// Format and Source encode the request body, as for events.Encode.
+	Format string
+	Source string
+}
+
+type Subscription struct {
+	ID  string `json:"id" bson:"_id"`
+	URL string `json:"url" bson:"url"`
+	// Secret signs the deliveries. It is only returned when the
+	// subscription is created.
+	Secret string `json:"secret,omitempty" bson:"secret"`
+	// Events filters the event types sent; empty sends all of them.
+	Events    []events.Type `json:"events" bson:"events"`
+	Active    bool          `json:"active" bson:"active"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+// Wants reports whether the subscription receives events of type t.
+func (s Subscription) Wants(t events.Type) bool {
+	return s.Active && (len(s.Events) == 0 || slices.Contains(s.Events, t))
+}
+
+func (s Subscription) validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL, got %q", ErrInvalid, s.URL)
+	}
+	for _, t := range s.Events {
+		if !slices.Contains(events.Types(), t) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalid, t)
+		}
+	}
+	return nil
+}
+
+// Delivery is one event on its way to one subscription. Body is stored
+// encoded so that retries and replays send the same bytes. ID is derived
+// from the event and subscription IDs, so an event published twice makes
+// one delivery per subscription.
+type Delivery struct {
+	ID             string      `json:"id" bson:"_id"`
+	SubscriptionID string      `json:"subscription_id" bson:"subscription_id"`
+	EventID        string      `json:"event_id" bson:"event_id"`
+	EventType      events.Type `json:"event_type" bson:"event_type"`
+	ContentType    string      `json:"content_type" bson:"content_type"`
+	Body           string      `json:"body" bson:"body"`
+	Status         string      `json:"status" bson:"status"`
+	Attempts       int         `json:"attempts" bson:"attempts"`
+	NextAttempt    time.Time   `json:"next_attempt" bson:"next_attempt"`
+	LeaseUntil     time.Time   `json:"-" bson:"lease_until"`
+	LastStatus     int         `json:"last_status,omitempty" bson:"last_status,omitempty"`
+	LastError      string      `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt      time.Time   `json:"created_at" bson:"created_at"`
+	DeliveredAt    time.Time   `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// deliverySpace derives delivery IDs from event and subscription IDs.
+var deliverySpace = uuid.MustParse("7c2e4a9d-1f3b-4e8a-b5d6-0a9c8e7f6d21")
+
+func deliveryID(eventID, subscriptionID string) string {
+	return uuid.NewSHA1(deliverySpace, []byte(eventID+"/"+subscriptionID)).String()
+}
+
+// Manager stores subscriptions and deliveries. As an events.Publisher it
+// queues a delivery for every active subscription that wants the event.
+type Manager struct {
+	store  store.Store
+	config Config
+	now    func() time.Time
+}
+
+func New(client store.Store, config Config) *Manager {
+	if config.Database == "" {
+		config.Database = DefaultDatabase
+	}
+	if config.Subscriptions == "" {
+		config.Subscriptions = DefaultSubscriptionCollection
+	}
+	if config.Deliveries == "" {
+		config.Deliveries = DefaultDeliveryCollection
+	}
+	if config.Source == "" {
+		config.Source = events.DefaultSource
+	}
+	return &Manager{store: client, config: config, now: time.Now}
+}
+
+func (m *Manager) subscriptions() store.Collection {
+	return m.store.Database(m.config.Database).Collection(m.config.Subscriptions)
+}
+
+func (m *Manager) deliveries() store.Collection {
+	return m.store.Database(m.config.Database).Collection(m.config.Deliveries)
+}
+
+// Subscribe stores a new active subscription and generates its secret
+// unless one is given.
+func (m *Manager) Subscribe(ctx context.Context, sub Subscription) (Subscription, error) {
+	if err := sub.validate(); err != nil {
+		return Subscription{}, err
+	}
+	if sub.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return Subscription{}, err
+		}
+		sub.Secret = secret
+	}
+	if sub.Events == nil {
+		sub.Events = []events.Type{}
+	}
+	sub.ID = uuid.New().String()
+	sub.Active = true
+	sub.CreatedAt = m.now().UTC()
+	sub.UpdatedAt = sub.CreatedAt
+	if _, err := m.subscriptions().InsertOne(ctx, sub); err != nil {
+		return Subscription{}, fmt.Errorf("webhook: %w", err)
+	}
+	return sub, nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("webhook: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func (m *Manager) Subscription(ctx context.Context, id string) (Subscription, error) {
+	var sub Subscription
+	err := m.subscriptions().FindOne(ctx, bson.M{"_id": id}).Decode(&sub)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Subscription{}, ErrNotFound
+	}
+	if err != nil {
+		return Subscription{}, fmt.Errorf("webhook: %w", err)
+	}
+	return sub, nil
+}
+
+func (m *Manager) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	cursor, err := m.subscriptions().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	subs := []Subscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	return subs, nil
+}
+
+// Update is a partial change to a subscription; nil fields are kept.
+type Update struct {
+	URL    *string        `json:"url"`
+	Events *[]events.Type `json:"events"`
+	Active *bool          `json:"active"`
+}
+
+func (m *Manager) Update(ctx context.Context, id string, update Update) (Subscription, error) {
+	sub, err := m.Subscription(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if update.URL != nil {
+		sub.URL = *update.URL
+	}
+	if update.Events != nil {
+		sub.Events = *update.Events
+	}
+	if update.Active != nil {
+		sub.Active = *update.Active
+	}
+	if err := sub.validate(); err != nil {
+		return Subscription{}, err
+	}
+	sub.UpdatedAt = m.now().UTC()
+	_, err = m.subscriptions().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"url":        sub.URL,
+		"events":     sub.Events,
+		"active":     sub.Active,
+		"updated_at": sub.UpdatedAt,
+	}})
+	if err != nil {
+		return Subscription{}, fmt.Errorf("webhook: %w", err)
+	}
+	return sub, nil
+}
+
+// Unsubscribe deletes a subscription. Its queued deliveries are
+// dead-lettered by the Dispatcher.
+func (m *Manager) Unsubscribe(ctx context.Context, id string) error {
+	result, err := m.subscriptions().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Manager) Publish(ctx context.Context, evts ...events.Event) error {
+	if len(evts) == 0 {
+		return nil
+	}
+	subs, err := m.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var docs []interface{}
+	now := m.now().UTC()
+	for _, event := range evts {
+		var body []byte
+		var contentType string
+		for _, sub := range subs {
+			if !sub.Wants(event.Type) {
+				continue
+			}
+			if body == nil {
+				if body, contentType, err = events.Encode(m.config.Format, m.config.Source, event); err != nil {
+					return fmt.Errorf("webhook: %s: %w", event.Type, err)
+				}
+			}
+			docs = append(docs, Delivery{
+				ID:             deliveryID(event.ID, sub.ID),
+				SubscriptionID: sub.ID,
+				EventID:        event.ID,
+				EventType:      event.Type,
+				ContentType:    contentType,
+				Body:           string(body),
+				Status:         StatusPending,
+				NextAttempt:    now,
+				CreatedAt:      now,
+			})
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	// deliveries already queued by an earlier publish of the same event are
+	// kept as they are
+	_, err = m.deliveries().InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !store.OnlyDuplicateKeys(err) {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) Close() error {
+	return nil
+}
+
+type Query struct {
+	SubscriptionID string
+	Status         string
+	Limit          int64
+}
+
+// Deliveries returns the newest deliveries first. Query{Status: StatusDead}
+// is the dead-letter list.
+func (m *Manager) Deliveries(ctx context.Context, query Query) ([]Delivery, error) {
+	filter := bson.M{}
+	if query.SubscriptionID != "" {
+		filter["subscription_id"] = query.SubscriptionID
+	}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+	if query.Limit <= 0 || query.Limit > maxQueryLimit {
+		query.Limit = maxQueryLimit
+	}
+	cursor, err := m.deliveries().Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(query.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	deliveries := []Delivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Replay queues a failed delivery to be sent again with a fresh set of
+// attempts.
+func (m *Manager) Replay(ctx context.Context, id string) (Delivery, error) {
+	var delivery Delivery
+	err := m.deliveries().FindOne(ctx, bson.M{"_id": id}).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Delivery{}, ErrNotFound
+	}
+	if err != nil {
+		return Delivery{}, fmt.Errorf("webhook: %w", err)
+	}
+	if delivery.Status == StatusDelivered || (delivery.Status == StatusPending && delivery.Attempts == 0) {
+		return Delivery{}, ErrNotReplayable
+	}
+
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = m.now().UTC()
+	delivery.LeaseUntil = time.Time{}
+	result, err := m.deliveries().UpdateOne(ctx, bson.M{"_id": id, "status": bson.M{"$ne": StatusDelivered}}, bson.M{"$set": bson.M{
+		"status":       delivery.Status,
+		"attempts":     delivery.Attempts,
+		"next_attempt": delivery.NextAttempt,
+		"lease_until":  delivery.LeaseUntil,
+	}})
+	if err != nil {
+		return Delivery{}, fmt.Errorf("webhook: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return Delivery{}, ErrNotReplayable
+	}
+	return delivery, nil
+}
+
+// Sign returns the signature header for body sent at t: the Unix time and
+// the hex HMAC-SHA256 of "<time>.<body>" under secret, as "t=<time>,v1=<mac>".
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + mac(secret, timestamp, body)
+}
+
+func mac(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks a signature header made by Sign and rejects it when its
+// time is more than tolerance away from now, which limits replayed
+// requests. Receivers can use it as a reference.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("webhook: malformed signature header")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook: signature timestamp out of tolerance")
+	}
+	expected := mac(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("webhook: signature mismatch")
+}
@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/mlog"
+	"github.com/sing3demons/auth-service/router"
+)
+
+// Register serves the subscription admin API and the delivery log.
+// middleware should restrict it to administrators.
+func Register(r router.MyRouter, m *Manager, middleware ...gin.HandlerFunc) router.MyRouter {
+	with := func(handler gin.HandlerFunc) []gin.HandlerFunc {
+		return append(append([]gin.HandlerFunc(nil), middleware...), handler)
+	}
+	r.POST("/api/v1/webhooks", with(m.create)...)
+	r.GET("/api/v1/webhooks", with(m.list)...)
+	r.GET("/api/v1/webhooks/deliveries", with(m.listDeliveries)...)
+	r.POST("/api/v1/webhooks/deliveries/:id/replay", with(m.replay)...)
+	r.GET("/api/v1/webhooks/:id", with(m.get)...)
+	r.PATCH("/api/v1/webhooks/:id", with(m.update)...)
+	r.DELETE("/api/v1/webhooks/:id", with(m.remove)...)
+	return r
+}
+
+func (m *Manager) respond(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "not found"})
+	case errors.Is(err, ErrNotReplayable):
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "message": err.Error()})
+	default:
+		mlog.L(c.Request.Context()).Error(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "webhook request failed"})
+	}
+}
+
+// create answers POST /api/v1/webhooks with {"url", "events", "secret"}.
+// The response is the only one that includes the secret.
+func (m *Manager) create(c *gin.Context) {
+	var body struct {
+		URL    string        `json:"url"`
+		Events []events.Type `json:"events"`
+		Secret string        `json:"secret"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	sub, err := m.Subscribe(c.Request.Context(), Subscription{URL: body.URL, Events: body.Events, Secret: body.Secret})
+	if err != nil {
+		m.respond(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "message": "webhook created", "data": sub})
+}
+
+func (m *Manager) list(c *gin.Context) {
+	subs, err := m.Subscriptions(c.Request.Context())
+	if err != nil {
+		m.respond(c, err)
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "webhooks", "data": subs})
+}
+
+func (m *Manager) get(c *gin.Context) {
+	sub, err := m.Subscription(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		m.respond(c, err)
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "webhook", "data": sub})
+}
+
+func (m *Manager) update(c *gin.Context) {
+	var update Update
+	if err := c.BindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	sub, err := m.Update(c.Request.Context(), c.Param("id"), update)
+	if err != nil {
+		m.respond(c, err)
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "webhook updated", "data": sub})
+}
+
+func (m *Manager) remove(c *gin.Context) {
+	if err := m.Unsubscribe(c.Request.Context(), c.Param("id")); err != nil {
+		m.respond(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "webhook deleted"})
+}
+
+// listDeliveries answers GET /api/v1/webhooks/deliveries?subscription=&status=&limit=;
+// status=dead lists the dead letters.
+func (m *Manager) listDeliveries(c *gin.Context) {
+	query := Query{SubscriptionID: c.Query("subscription"), Status: c.Query("status")}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		query.Limit = limit
+	}
+	deliveries, err := m.Deliveries(c.Request.Context(), query)
+	if err != nil {
+		m.respond(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "webhook deliveries", "data": deliveries})
+}
+
+func (m *Manager) replay(c *gin.Context) {
+	delivery, err := m.Replay(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		m.respond(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "webhook delivery queued", "data": delivery})
+}
@@ -0,0 +1,238 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/auth-service/events"
+	"github.com/sing3demons/auth-service/router"
+	"github.com/sing3demons/auth-service/store"
+	"github.com/sing3demons/auth-service/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+// endpoint records the requests it receives and answers with status.
+type endpoint struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, r)
+	e.bodies = append(e.bodies, body)
+	w.WriteHeader(e.status)
+}
+
+func (e *endpoint) setStatus(status int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = status
+}
+
+func (e *endpoint) received() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.requests)
+}
+
+func TestSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"1"}`)
+	header := webhook.Sign("whsec_test", now, body)
+	assert.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+
+	assert.NoError(t, webhook.Verify("whsec_test", header, body, 5*time.Minute, now.Add(time.Minute)))
+	assert.ErrorContains(t, webhook.Verify("whsec_other", header, body, 5*time.Minute, now), "mismatch")
+	assert.ErrorContains(t, webhook.Verify("whsec_test", header, []byte(`{"id":"2"}`), 5*time.Minute, now), "mismatch")
+	assert.ErrorContains(t, webhook.Verify("whsec_test", header, body, 5*time.Minute, now.Add(10*time.Minute)), "tolerance")
+	assert.ErrorContains(t, webhook.Verify("whsec_test", "v1=abc", body, 5*time.Minute, now), "malformed")
+}
+
+func TestDispatch(t *testing.T) {
+	ctx := context.TODO()
+	manager := webhook.New(store.NewMemoryStore(), webhook.Config{})
+	target := &endpoint{status: http.StatusOK}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	all, err := manager.Subscribe(ctx, webhook.Subscription{URL: server.URL})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(all.Secret, "whsec_"))
+	_, err = manager.Subscribe(ctx, webhook.Subscription{URL: server.URL + "/logins", Events: []events.Type{events.UserLoggedIn}})
+	assert.NoError(t, err)
+	_, err = manager.Subscribe(ctx, webhook.Subscription{URL: "ftp://partner"})
+	assert.ErrorIs(t, err, webhook.ErrInvalid)
+	_, err = manager.Subscribe(ctx, webhook.Subscription{URL: server.URL, Events: []events.Type{"user.renamed"}})
+	assert.ErrorIs(t, err, webhook.ErrInvalid)
+
+	registered := events.New(events.UserRegistered, "u1", events.Registered{ID: "u1", Email: "a@example.com"})
+	assert.NoError(t, manager.Publish(ctx, registered))
+	assert.NoError(t, manager.Publish(ctx, registered), "a repeated event is queued once")
+	queued, err := manager.Deliveries(ctx, webhook.Query{Status: webhook.StatusPending})
+	assert.NoError(t, err)
+	assert.Len(t, queued, 1, "the logins subscription filters registrations out")
+
+	dispatcher := webhook.NewDispatcher(manager, server.Client(), webhook.DispatcherConfig{}, slog.Default())
+	delivered, err := dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	assert.Equal(t, 1, target.received())
+	req, body := target.requests[0], target.bodies[0]
+	assert.Equal(t, events.ContentTypeJSON, req.Header.Get("Content-Type"))
+	assert.Equal(t, string(events.UserRegistered), req.Header.Get(webhook.HeaderEvent))
+	assert.Equal(t, queued[0].ID, req.Header.Get(webhook.HeaderID))
+	assert.Equal(t, registered.ID, req.Header.Get(webhook.HeaderEventID))
+	assert.NoError(t, webhook.Verify(all.Secret, req.Header.Get(webhook.HeaderSignature), body, time.Minute, time.Now()))
+	var envelope struct {
+		Type    events.Type
+		Subject string
+		Data    events.Registered
+	}
+	assert.NoError(t, json.Unmarshal(body, &envelope))
+	assert.Equal(t, "u1", envelope.Subject)
+	assert.Equal(t, "a@example.com", envelope.Data.Email)
+
+	delivered, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, delivered, "delivered webhooks are not sent again")
+}
+
+func TestDeadLetterAndReplay(t *testing.T) {
+	ctx := context.TODO()
+	manager := webhook.New(store.NewMemoryStore(), webhook.Config{})
+	target := &endpoint{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	_, err := manager.Subscribe(ctx, webhook.Subscription{URL: server.URL})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Publish(ctx, events.New(events.UserLoggedIn, "u1", events.LoggedIn{ID: "u1"})))
+
+	dispatcher := webhook.NewDispatcher(manager, server.Client(), webhook.DispatcherConfig{
+		Backoff:     10 * time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+		MaxAttempts: 2,
+	}, slog.Default())
+
+	delivered, err := dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, delivered)
+	pending, _ := manager.Deliveries(ctx, webhook.Query{})
+	assert.Equal(t, webhook.StatusPending, pending[0].Status)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, pending[0].LastStatus)
+
+	// not retried before the backoff
+	_, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, target.received())
+
+	time.Sleep(20 * time.Millisecond)
+	_, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, target.received())
+
+	dead, err := manager.Deliveries(ctx, webhook.Query{Status: webhook.StatusDead})
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, 2, dead[0].Attempts)
+
+	target.setStatus(http.StatusNoContent)
+	_, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, target.received(), "dead letters wait for a replay")
+
+	replayed, err := manager.Replay(ctx, dead[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, webhook.StatusPending, replayed.Status)
+	delivered, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, target.bodies[0], target.bodies[2], "a replay sends the same body")
+
+	_, err = manager.Replay(ctx, dead[0].ID)
+	assert.ErrorIs(t, err, webhook.ErrNotReplayable)
+	_, err = manager.Replay(ctx, "missing")
+	assert.ErrorIs(t, err, webhook.ErrNotFound)
+}
+
+func TestDispatchRemovedSubscription(t *testing.T) {
+	ctx := context.TODO()
+	manager := webhook.New(store.NewMemoryStore(), webhook.Config{})
+	target := &endpoint{status: http.StatusOK}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	sub, err := manager.Subscribe(ctx, webhook.Subscription{URL: server.URL})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Publish(ctx, events.New(events.UserLoggedIn, "u1", events.LoggedIn{ID: "u1"})))
+	assert.NoError(t, manager.Unsubscribe(ctx, sub.ID))
+
+	_, err = webhook.NewDispatcher(manager, server.Client(), webhook.DispatcherConfig{}, slog.Default()).DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, target.received())
+	dead, _ := manager.Deliveries(ctx, webhook.Query{Status: webhook.StatusDead})
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "subscription deleted", dead[0].LastError)
+}
+
+func TestAdminAPI(t *testing.T) {
+	manager := webhook.New(store.NewMemoryStore(), webhook.Config{})
+	r := router.New()
+	webhook.Register(r, manager)
+	handler := r.(http.Handler)
+
+	do := func(method, path, body string) (int, map[string]any) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	status, response := do(http.MethodPost, "/api/v1/webhooks", `{"url":"https://partner.example.com/hook","events":["user.registered"]}`)
+	assert.Equal(t, http.StatusCreated, status)
+	created := response["data"].(map[string]any)
+	id := created["id"].(string)
+	assert.NotEmpty(t, created["secret"])
+
+	status, _ = do(http.MethodPost, "/api/v1/webhooks", `{"url":"partner"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, response = do(http.MethodGet, "/api/v1/webhooks", "")
+	assert.Equal(t, http.StatusOK, status)
+	listed := response["data"].([]any)
+	assert.Len(t, listed, 1)
+	assert.NotContains(t, listed[0], "secret")
+
+	status, response = do(http.MethodPatch, "/api/v1/webhooks/"+id, `{"active":false}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, false, response["data"].(map[string]any)["active"])
+	assert.Equal(t, []any{"user.registered"}, response["data"].(map[string]any)["events"])
+
+	status, _ = do(http.MethodGet, "/api/v1/webhooks/deliveries?status=dead", "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do(http.MethodPost, "/api/v1/webhooks/deliveries/missing/replay", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = do(http.MethodDelete, "/api/v1/webhooks/"+id, "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do(http.MethodGet, "/api/v1/webhooks/"+id, "")
+	assert.Equal(t, http.StatusNotFound, status)
+}